@@ -0,0 +1,300 @@
+package gopds
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Roles, from least to most trusted. Each role may do everything the ones
+// before it can.
+const (
+	// RoleGuest may browse the catalog.
+	RoleGuest = "guest"
+	// RoleReader may also download and read books.
+	RoleReader = "reader"
+	// RoleLibrarian may also edit books and feeds.
+	RoleLibrarian = "librarian"
+	// RoleAdmin may also manage users, and sees every feed.
+	RoleAdmin = "admin"
+)
+
+var roleRanks = map[string]int{
+	RoleGuest:     1,
+	RoleReader:    2,
+	RoleLibrarian: 3,
+	RoleAdmin:     4,
+}
+
+func validRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+func (u *User) role() string {
+	if u.Role != "" {
+		return u.Role
+	}
+	// accounts made before roles were either admins or plain users
+	if u.Admin {
+		return RoleAdmin
+	}
+	return RoleReader
+}
+
+// Can reports whether the user's role includes role.
+func (u *User) Can(role string) bool {
+	return roleRanks[u.role()] >= roleRanks[role]
+}
+
+// allowed reports whether the request's user has role. While there are
+// no users anyone may browse and download, but nothing more: the first
+// account has to come from the -admin flag, or whoever reached the port
+// first could make themselves admin.
+func (srv *Server) allowed(r *http.Request, role string) bool {
+	user := UserFromRequest(r)
+	if user == nil {
+		return !srv.hasUsers() && roleRanks[role] <= roleRanks[RoleReader]
+	}
+	return user.Can(role)
+}
+
+// restricted reports whether the feed is limited to its User and Groups.
+func (f *OpdsFeedDB) restricted() bool {
+	return f.User != "" || len(f.Groups) > 0
+}
+
+// visibleTo reports whether user may see the feed. A nil user is the
+// server itself, or anyone while there are no users.
+func (f *OpdsFeedDB) visibleTo(user *User) bool {
+	if !f.restricted() || user == nil || user.Can(RoleAdmin) {
+		return true
+	}
+	if f.User == user.Name {
+		return true
+	}
+	for _, v := range f.Groups {
+		if containsString(user.Groups, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// access is what one user may see of the catalog: everything except the
+// restricted feeds they aren't let into, the feeds below those, and the
+// books any of them list. A book listed by a restricted feed the user may
+// see stays visible.
+type access struct {
+	hiddenFeeds map[string]bool
+	hiddenBooks map[string]bool
+}
+
+func (srv *Server) accessFor(user *User) (*access, error) {
+	if user == nil || user.Can(RoleAdmin) {
+		return &access{make(map[string]bool), make(map[string]bool)}, nil
+	}
+	feeds, err := srv.nav.get(srv)
+	if err != nil {
+		return nil, err
+	}
+	return feedAccess(feeds, user), nil
+}
+
+// feedAccess works out what user may see of feeds.
+func feedAccess(feeds map[string]*OpdsFeedDB, user *User) *access {
+	acc := &access{make(map[string]bool), make(map[string]bool)}
+	shownFeeds, shownBooks := make(map[string]bool), make(map[string]bool)
+	for name, feed := range feeds {
+		if !feed.restricted() {
+			continue
+		}
+		if feed.Shelf {
+			// shelves neither hide nor grant access to their books
+			if !feed.visibleTo(user) {
+				acc.hiddenFeeds[name] = true
+			}
+		} else if feed.visibleTo(user) {
+			collectFeed(feeds, name, shownFeeds, shownBooks)
+		} else {
+			collectFeed(feeds, name, acc.hiddenFeeds, acc.hiddenBooks)
+		}
+	}
+	for name := range shownFeeds {
+		delete(acc.hiddenFeeds, name)
+	}
+	for id := range shownBooks {
+		delete(acc.hiddenBooks, id)
+	}
+	return acc
+}
+
+// navCache keeps the decoded nav database for access checks, which run
+// on every guarded request, each cover and thumbnail included. Writes to
+// nav go through setFeed and delFeed, which empty it.
+type navCache struct {
+	sync.Mutex
+	feeds map[string]*OpdsFeedDB
+}
+
+// get returns the cached feeds, which callers must not change. Loading
+// under the lock keeps a write during the load from being missed.
+func (c *navCache) get(srv *Server) (map[string]*OpdsFeedDB, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.feeds != nil {
+		return c.feeds, nil
+	}
+	iter, err := srv.DB.NewIterator("nav")
+	if err != nil {
+		return nil, err
+	}
+	feeds := make(map[string]*OpdsFeedDB)
+	for iter.Next() {
+		feed := &OpdsFeedDB{}
+		if json.Unmarshal(iter.Value(), feed) == nil {
+			feeds[string(iter.Key())] = feed
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	c.feeds = feeds
+	return feeds, nil
+}
+
+func (c *navCache) forget() {
+	c.Lock()
+	defer c.Unlock()
+	c.feeds = nil
+}
+
+// setFeed stores a feed in nav.
+func (srv *Server) setFeed(name string, feed *OpdsFeedDB) error {
+	defer srv.nav.forget()
+	return srv.DB.Set("nav", name, feed)
+}
+
+// delFeed removes a feed from nav.
+func (srv *Server) delFeed(name string) error {
+	defer srv.nav.forget()
+	return srv.DB.Del("nav", name)
+}
+
+// collectFeed adds the named feed, the feeds below it and the books they
+// list to names and books.
+func collectFeed(feeds map[string]*OpdsFeedDB, name string, names, books map[string]bool) {
+	feed, ok := feeds[name]
+	if !ok || names[name] {
+		return
+	}
+	names[name] = true
+	for _, v := range feed.Entries {
+		switch feed.Type {
+		case Acq:
+			books[v] = true
+		case Nav:
+			collectFeed(feeds, v, names, books)
+		}
+	}
+}
+
+// filter drops the entries of a feed of type feedType the user may not see.
+func (acc *access) filter(entries []*OpdsEntry, feedType byte) []*OpdsEntry {
+	if len(acc.hiddenFeeds) == 0 && len(acc.hiddenBooks) == 0 {
+		return entries
+	}
+	out := []*OpdsEntry{}
+	for _, v := range entries {
+		if feedType == Nav && acc.hiddenFeeds[v.Category] {
+			continue
+		}
+		if (feedType == Acq || feedType == Search) && acc.hiddenBooks[entryId(v)] {
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// visibleBooks counts the books of ids the user may see.
+func (acc *access) visibleBooks(ids []string) int {
+	n := 0
+	for _, v := range ids {
+		if !acc.hiddenBooks[v] {
+			n++
+		}
+	}
+	return n
+}
+
+// bookVisible reports whether the request's user may see book id.
+func (srv *Server) bookVisible(r *http.Request, id string) (bool, error) {
+	acc, err := srv.accessFor(UserFromRequest(r))
+	if err != nil {
+		return false, err
+	}
+	return !acc.hiddenBooks[id], nil
+}
+
+// pathId names the book of a route by the first path element below it.
+func pathId(r *http.Request) string {
+	return strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+}
+
+// formId names the book of a route by its id parameter.
+func formId(r *http.Request) string {
+	return r.FormValue("id")
+}
+
+// guardBook lets fun handle requests from users with role who may see
+// the book bookId finds in the request.
+func (srv *Server) guardBook(role string, bookId func(*http.Request) string, fun http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		srv.serveGuarded(w, r, role, bookId(r), fun)
+	}
+}
+
+// guardFiles protects the /get/ file server. Books need the reader role,
+// covers and thumbnails are part of browsing, and nothing else is served.
+func (srv *Server) guardFiles(fun http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		components := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if len(components) != 2 || components[1] == "" {
+			http.Error(w, "Not found", 404)
+			return
+		}
+		id := components[1]
+		switch components[0] {
+		case "books":
+			srv.serveGuarded(w, r, RoleReader, id, func(w http.ResponseWriter, r *http.Request) {
+				srv.recordDownload(r, id, "")
+				fun(w, r)
+			})
+		case "covers", "thumbs":
+			srv.serveGuarded(w, r, RoleGuest, id, fun)
+		default:
+			http.Error(w, "Not found", 404)
+		}
+	}
+}
+
+func (srv *Server) serveGuarded(w http.ResponseWriter, r *http.Request, role, id string, fun http.HandlerFunc) {
+	if !srv.allowed(r, role) {
+		http.Error(w, "Forbidden", 403)
+		return
+	}
+	ok, err := srv.bookVisible(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !ok {
+		// the same answer as for a book that doesn't exist
+		http.Error(w, "Book not found", 404)
+		return
+	}
+	fun(w, r)
+}
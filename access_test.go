@@ -0,0 +1,180 @@
+package gopds
+
+import (
+	"reflect"
+	"testing"
+)
+
+// newTestServer opens a server with an empty catalog in a temporary
+// directory.
+func newTestServer(t *testing.T) *Server {
+	srv, err := NewServer(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+func testFeed(feedType byte, entries ...string) *OpdsFeedDB {
+	return &OpdsFeedDB{OpdsCommon: &OpdsCommon{Type: feedType}, Entries: entries}
+}
+
+func keys(m map[string]bool) map[string]bool {
+	out := make(map[string]bool)
+	for k, v := range m {
+		if v {
+			out[k] = true
+		}
+	}
+	return out
+}
+
+func set(names ...string) map[string]bool {
+	out := make(map[string]bool)
+	for _, v := range names {
+		out[v] = true
+	}
+	return out
+}
+
+func TestCollectFeed(t *testing.T) {
+	feeds := map[string]*OpdsFeedDB{
+		"a": testFeed(Nav, "b", "c", "missing"),
+		"b": testFeed(Acq, "1", "2"),
+		// a cycle back to a
+		"c": testFeed(Nav, "a", "d"),
+		"d": testFeed(Acq, "2", "3"),
+		"e": testFeed(Acq, "4"),
+	}
+	tests := []struct {
+		start        string
+		names, books map[string]bool
+	}{
+		{"a", set("a", "b", "c", "d"), set("1", "2", "3")},
+		{"c", set("a", "b", "c", "d"), set("1", "2", "3")},
+		{"e", set("e"), set("4")},
+		{"missing", set(), set()},
+	}
+	for _, tt := range tests {
+		names, books := make(map[string]bool), make(map[string]bool)
+		collectFeed(feeds, tt.start, names, books)
+		if !reflect.DeepEqual(names, tt.names) || !reflect.DeepEqual(books, tt.books) {
+			t.Errorf("collectFeed(%s) = %v %v, want %v %v", tt.start, names, books, tt.names, tt.books)
+		}
+	}
+}
+
+func TestFeedAccess(t *testing.T) {
+	private := testFeed(Acq, "a1", "shared")
+	private.User = "alice"
+	staff := testFeed(Nav, "staffbooks")
+	staff.Groups = []string{"staff"}
+	grants := testFeed(Acq, "shared")
+	grants.Groups = []string{"readers"}
+	shelf := testFeed(Acq, "p1", "a1")
+	shelf.User, shelf.Shelf = "bob", true
+	feeds := map[string]*OpdsFeedDB{
+		"root":       testFeed(Nav, "public", "private", "staff", "grants"),
+		"public":     testFeed(Acq, "p1", "shared"),
+		"private":    private,
+		"staff":      staff,
+		"staffbooks": testFeed(Acq, "s1"),
+		"grants":     grants,
+		"shelf:x":    shelf,
+	}
+	tests := []struct {
+		user         *User
+		feeds, books map[string]bool
+	}{
+		{&User{Name: "alice", Role: RoleReader},
+			set("staff", "staffbooks", "grants", "shelf:x"), set("s1")},
+		{&User{Name: "bob", Role: RoleGuest, Groups: []string{"readers"}},
+			set("private", "staff", "staffbooks"), set("a1", "s1")},
+		{&User{Name: "carol", Role: RoleLibrarian, Groups: []string{"staff"}},
+			set("private", "grants", "shelf:x"), set("a1", "shared")},
+		{&User{Name: "old", Admin: true}, set(), set()},
+		{&User{Name: "root", Role: RoleAdmin}, set(), set()},
+	}
+	for _, tt := range tests {
+		var acc *access
+		if tt.user.Can(RoleAdmin) {
+			acc = &access{make(map[string]bool), make(map[string]bool)}
+		} else {
+			acc = feedAccess(feeds, tt.user)
+		}
+		if got := keys(acc.hiddenFeeds); !reflect.DeepEqual(got, tt.feeds) {
+			t.Errorf("%s: hidden feeds %v, want %v", tt.user.Name, got, tt.feeds)
+		}
+		if got := keys(acc.hiddenBooks); !reflect.DeepEqual(got, tt.books) {
+			t.Errorf("%s: hidden books %v, want %v", tt.user.Name, got, tt.books)
+		}
+	}
+}
+
+func TestAccessFilter(t *testing.T) {
+	acc := &access{set("private"), set("b2")}
+	navs := []*OpdsEntry{
+		{OpdsMeta: &OpdsMeta{Category: "public"}},
+		{OpdsMeta: &OpdsMeta{Category: "private"}},
+	}
+	books := []*OpdsEntry{{Id: "urn:uuid:b1"}, {Id: "urn:uuid:b2"}}
+	if got := acc.filter(navs, Nav); len(got) != 1 || got[0].Category != "public" {
+		t.Errorf("nav entries %v", got)
+	}
+	for _, feedType := range []byte{Acq, Search} {
+		if got := acc.filter(books, feedType); len(got) != 1 || got[0].Id != "urn:uuid:b1" {
+			t.Errorf("type %d: book entries %v", feedType, got)
+		}
+	}
+	none := &access{make(map[string]bool), make(map[string]bool)}
+	if got := none.filter(books, Acq); len(got) != 2 {
+		t.Errorf("unrestricted filter dropped entries: %v", got)
+	}
+}
+
+func TestAccessForFollowsWrites(t *testing.T) {
+	srv := newTestServer(t)
+	bob := &User{Name: "bob", Role: RoleReader}
+	hidden := func() map[string]bool {
+		acc, err := srv.accessFor(bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return keys(acc.hiddenBooks)
+	}
+
+	feed := testFeed(Acq, "b1")
+	feed.Name = "private"
+	feed.User = "alice"
+	if err := srv.setFeed(feed.Name, feed); err != nil {
+		t.Fatal(err)
+	}
+	if got := hidden(); !reflect.DeepEqual(got, set("b1")) {
+		t.Errorf("after restricting: %v", got)
+	}
+	feed.User = "bob"
+	if err := srv.setFeed(feed.Name, feed); err != nil {
+		t.Fatal(err)
+	}
+	if got := hidden(); len(got) != 0 {
+		t.Errorf("after granting: %v", got)
+	}
+	feed.User = "alice"
+	srv.setFeed(feed.Name, feed)
+	hidden()
+	if err := srv.delFeed(feed.Name); err != nil {
+		t.Fatal(err)
+	}
+	if got := hidden(); len(got) != 0 {
+		t.Errorf("after deleting: %v", got)
+	}
+}
+
+func TestMissingFeedSearches(t *testing.T) {
+	srv := newTestServer(t)
+	for _, name := range []string{"x", "nofeed", "search:", "search:x", "author:"} {
+		if _, err := srv.getFeedDB(&FeedRequest{Name: name}); err != nil {
+			t.Errorf("%q: %s", name, err)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"time"
 )
 
 func stripPrefix(prefix string, fun http.HandlerFunc) http.HandlerFunc {
@@ -16,6 +18,8 @@ func stripPrefix(prefix string, fun http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 		r.URL.Path = r.URL.Path[n:]
+		// keep the escaped form in step so handlers can split on it
+		r.URL.RawPath = strings.TrimPrefix(r.URL.RawPath,prefix)
 		fun(w,r)
 	}
 }
@@ -34,9 +38,38 @@ func (srv *Server) handleAPI(w http.ResponseWriter,r *http.Request) {
 	log.Printf("API Request:")
 	log.Printf("%s, %d: %v",r.URL.Path,len(components),components)
 	if len(components) > 1 {
+		// anyone allowed in may read, and manage their own tokens and shelves
+		role := RoleGuest
 		switch components[1] {
+		case "user":
+			role = RoleAdmin
+		case "token","shelf","status","downloads":
+		default:
+			if r.Method != "GET" {
+				role = RoleLibrarian
+			}
+		}
+		if !srv.allowed(r,role) {
+			if UserFromRequest(r) == nil {
+				http.Error(w,errNoAdmin.Error(),403)
+				return
+			}
+			http.Error(w,"Forbidden",403)
+			return
+		}
+		switch components[1] {
+		case "user":
+			stripPrefix("/user",srv.handleUser)(w,r)
+		case "token":
+			stripPrefix("/token",srv.handleToken)(w,r)
+		case "shelf":
+			stripPrefix("/shelf",srv.handleShelf)(w,r)
+		case "status":
+			stripPrefix("/status",srv.guardBook(role,pathId,srv.handleStatus))(w,r)
+		case "downloads":
+			srv.handleDownloads(w,r)
 		case "book":
-			stripPrefix("/book",srv.handleBook)(w,r)
+			stripPrefix("/book",srv.guardBook(role,pathId,srv.handleBook))(w,r)
 		case "feed":
 			stripPrefix("/feed",srv.handleFeed)(w,r)
 		}
@@ -69,6 +102,36 @@ func (srv *Server) handleBook(w http.ResponseWriter,r *http.Request) {
 			http.Error(w,err.Error(),500)
 		}
 	case "PUT":
+		book := &OpdsEntry{}
+		err := srv.DB.Get("books",id,book)
+		if err != nil {
+			http.Error(w,"Book not found",404)
+			return
+		}
+		if len(components) > 2 && components[2] == "cover" {
+			err = srv.SetCover(id,r.Body)
+			if err != nil {
+				http.Error(w,err.Error(),400)
+			}
+			return
+		}
+		body,err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w,err.Error(),400)
+			return
+		}
+		meta,err := editableMeta(book.OpdsMeta,body)
+		if err != nil {
+			http.Error(w,"Bad metadata: "+err.Error(),400)
+			return
+		}
+		err = srv.UpdateBook(id,meta)
+		if err != nil {
+			http.Error(w,err.Error(),500)
+			return
+		}
+		out,_ := json.MarshalIndent(meta,"","  ")
+		fmt.Fprintf(w,"%s",out)
 	}
 }
 
@@ -76,4 +139,173 @@ func (srv *Server) handleFeed(w http.ResponseWriter,r *http.Request) {
 	components := strings.Split(r.URL.Path,"/")
 	log.Printf("Feed Request:")
 	log.Printf("%s, %d: %v",r.URL.Path,len(components),components)
+	if len(components) < 2 || components[1] == "" {
+		http.Error(w,"Must give feed name",404)
+		return
+	}
+	name := components[1]
+	acc,err := srv.accessFor(UserFromRequest(r))
+	if err != nil {
+		http.Error(w,err.Error(),500)
+		return
+	}
+	feed := &OpdsFeedDB{}
+	err = srv.DB.Get("nav",name,feed)
+	exists := err == nil && !acc.hiddenFeeds[name]
+	switch r.Method {
+	case "GET":
+		if !exists {
+			http.Error(w,"Feed not found",404)
+			return
+		}
+		out,_ := json.MarshalIndent(feed,"","  ")
+		fmt.Fprintf(w,"%s",out)
+	case "DELETE":
+		if !exists {
+			http.Error(w,"Feed not found",404)
+			return
+		}
+		if name == "root" {
+			http.Error(w,"Can't delete the root feed",400)
+			return
+		}
+		err = srv.delFeed(name)
+		if err == nil {
+			err = srv.orphanFeeds(name)
+		}
+		if err != nil {
+			http.Error(w,err.Error(),500)
+		}
+	case "PUT":
+		if err == nil && !exists {
+			http.Error(w,"Feed not found",404)
+			return
+		}
+		update := &OpdsFeedDB{}
+		err = json.NewDecoder(r.Body).Decode(update)
+		if err != nil || update.OpdsCommon == nil {
+			http.Error(w,"Bad feed",400)
+			return
+		}
+		if update.Type != Nav && update.Type != Acq {
+			http.Error(w,"Feeds must be navigation or acquisition feeds",400)
+			return
+		}
+		if update.Query != "" && update.Type != Acq {
+			http.Error(w,"Only acquisition feeds can have a query",400)
+			return
+		}
+		update.Name = name
+		update.Id = "urn:uuid:" + Uuidgen()
+		if exists {
+			update.Id = feed.Id
+			if update.Parent == "" {
+				update.Parent = feed.Parent
+			}
+		}
+		if update.Parent != "" {
+			if ok,_ := srv.DB.Exists("nav",update.Parent); !ok || update.Parent == name {
+				http.Error(w,"Parent feed not found",400)
+				return
+			}
+		}
+		update.Updated = time.Now().Format(time.RFC3339)
+		err = srv.setFeed(name,update)
+		if err == nil {
+			err = srv.upgradeFeeds()
+		}
+		if err != nil {
+			http.Error(w,err.Error(),500)
+			return
+		}
+		out,_ := json.MarshalIndent(update,"","  ")
+		fmt.Fprintf(w,"%s",out)
+	}
+}
+
+type userUpdate struct {
+	Password string
+	Role string
+	Groups []string
+}
+
+func (srv *Server) handleUser(w http.ResponseWriter,r *http.Request) {
+	components := strings.Split(r.URL.Path,"/")
+	name := ""
+	if len(components) > 1 {
+		name = components[1]
+	}
+	switch r.Method {
+	case "GET":
+		users,err := srv.Users()
+		if err != nil {
+			http.Error(w,err.Error(),500)
+			return
+		}
+		// never hand out the password hashes
+		list := make([]map[string]interface{},len(users))
+		for i,v := range users {
+			list[i] = map[string]interface{}{"Name": v.Name,"Role": v.role(),"Groups": v.Groups}
+		}
+		js,_ := json.MarshalIndent(list,"","  ")
+		fmt.Fprintf(w,"%s",js)
+	case "PUT":
+		update := &userUpdate{}
+		err := json.NewDecoder(r.Body).Decode(update)
+		if err != nil {
+			http.Error(w,"Bad user: "+err.Error(),400)
+			return
+		}
+		if update.Role == "" {
+			update.Role = RoleReader
+		}
+		err = srv.SetUser(name,update.Password,update.Role,update.Groups)
+		if err != nil {
+			http.Error(w,err.Error(),400)
+		}
+	case "DELETE":
+		err := srv.DelUser(name)
+		if err != nil {
+			http.Error(w,err.Error(),404)
+		}
+	}
+}
+
+func (srv *Server) handleToken(w http.ResponseWriter,r *http.Request) {
+	user := UserFromRequest(r)
+	if user == nil {
+		http.Error(w,errNoAccount.Error(),400)
+		return
+	}
+	components := strings.Split(r.URL.Path,"/")
+	switch r.Method {
+	case "GET":
+		tokens,err := srv.Tokens(user.Name)
+		if err != nil {
+			http.Error(w,err.Error(),500)
+			return
+		}
+		out,_ := json.MarshalIndent(tokens,"","  ")
+		fmt.Fprintf(w,"%s",out)
+	case "POST":
+		token,t,err := srv.NewToken(user.Name,r.FormValue("name"))
+		if err != nil {
+			http.Error(w,err.Error(),500)
+			return
+		}
+		out,_ := json.MarshalIndent(map[string]interface{}{"Token": token,"Id": t.Id,"Name": t.Name},"","  ")
+		fmt.Fprintf(w,"%s",out)
+	case "DELETE":
+		if len(components) < 2 {
+			http.Error(w,"Must give token id",404)
+			return
+		}
+		t := &Token{}
+		err := srv.DB.Get("tokens",components[1],t)
+		if err != nil || (t.User != user.Name && !user.Can(RoleAdmin)) {
+			http.Error(w,errBadToken.Error(),404)
+			return
+		}
+		srv.DB.Del("tokens",t.Id)
+	}
 }
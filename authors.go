@@ -0,0 +1,162 @@
+package gopds
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SortKey returns the file-as form of the name, deriving "Last, First"
+// from the display name when the book didn't supply one.
+func (a *OpdsAuthor) SortKey() string {
+	if a.FileAs != "" {
+		return a.FileAs
+	}
+	name := strings.TrimSpace(a.Name)
+	i := strings.LastIndex(name," ")
+	if i < 0 || strings.Contains(name,",") {
+		return name
+	}
+	return name[i+1:] + ", " + name[:i]
+}
+
+func authorFeedName(name string) string {
+	return "author:" + name
+}
+
+// addAuthorLinks points authors without a uri of their own at their
+// browse feed.
+func addAuthorLinks(entry *OpdsEntry) {
+	for _,v := range entry.Authors {
+		if v.Uri == "" && v.Name != "" {
+			v.Uri = "/catalog/" + url.PathEscape(authorFeedName(v.Name))
+		}
+	}
+}
+
+func (srv *Server) allBooks() ([]*OpdsEntry,error) {
+	booksBytes,err := srv.DB.GetAll("books")
+	if err != nil {
+		return nil,err
+	}
+	books := make([]*OpdsEntry,len(booksBytes))
+	for i,_ := range books {
+		books[i] = &OpdsEntry{}
+		err := json.Unmarshal(booksBytes[i],books[i])
+		if err != nil {
+			return nil,err
+		}
+	}
+	return books,nil
+}
+
+// authorBooks lists the ids of every book naming author among its authors.
+func (srv *Server) authorBooks(author string) ([]string,error) {
+	books,err := srv.allBooks()
+	if err != nil {
+		return nil,err
+	}
+	ids := []string{}
+	for _,v := range books {
+		for _,a := range v.Authors {
+			if strings.EqualFold(a.Name,author) {
+				ids = append(ids,v.Id)
+				break
+			}
+		}
+	}
+	return ids,nil
+}
+
+// getAuthorEntries builds a navigation entry per distinct author, titled
+// with the sort key so the index reads "Last, First". Only books acc
+// shows are counted.
+func (srv *Server) getAuthorEntries(acc *access) ([]*OpdsEntry,error) {
+	books,err := srv.allBooks()
+	if err != nil {
+		return nil,err
+	}
+	books = acc.filter(books,Acq)
+	seen := make(map[string]*OpdsEntry)
+	entries := []*OpdsEntry{}
+	for _,v := range books {
+		for _,a := range v.Authors {
+			key := strings.ToLower(a.Name)
+			if a.Name == "" {
+				continue
+			}
+			if entry,ok := seen[key]; ok {
+				entry.Order++
+				continue
+			}
+			name := authorFeedName(a.Name)
+			entry := &OpdsEntry{Id: "urn:uuid:" + NameUuid(authorFeedName(key)),
+				OpdsMeta: &OpdsMeta{Title: a.SortKey(),Category: name},
+				Updated: v.Updated,
+				Order: 1}
+			entry.Links = []*OpdsLink{&OpdsLink{Href: "/catalog/" + url.PathEscape(name),
+				Type: kindType(Acq),
+				Rel: "subsection"}}
+			seen[key] = entry
+			entries = append(entries,entry)
+		}
+	}
+	for _,v := range entries {
+		v.Content = &OpdsContent{Type: "text",Content: bookCount(v.Order)}
+		v.Order = 0
+	}
+	return entries,nil
+}
+
+func containsString(list []string,s string) bool {
+	for _,v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func bookCount(n int) string {
+	if n == 1 {
+		return "1 book"
+	}
+	return strconv.Itoa(n) + " books"
+}
+
+// upgradeBooks moves the single author of books stored by older versions
+// into the author list, hashes books stored before kosync support, indexes
+// those hashed before the index, and takes the last update as the added
+// time of books that lack one.
+func (srv *Server) upgradeBooks() error {
+	books,err := srv.allBooks()
+	if err != nil {
+		return err
+	}
+	for _,v := range books {
+		if v.PartialMD5 != "" {
+			if ok,_ := srv.DB.Exists("partialmd5",v.PartialMD5); !ok {
+				srv.indexPartialMD5(v.PartialMD5,v.Id)
+			}
+		}
+		if v.LegacyAuthor == nil && v.PartialMD5 != "" && v.Added != "" {
+			continue
+		}
+		if v.Added == "" {
+			v.Added = v.Updated
+		}
+		if v.LegacyAuthor != nil && len(v.Authors) == 0 {
+			v.Authors = []*OpdsAuthor{v.LegacyAuthor}
+		}
+		v.LegacyAuthor = nil
+		if v.PartialMD5 == "" {
+			srv.setPartialMD5(v.Id,v.OpdsMeta)
+		}
+		err = srv.DB.Set("books",v.Id,v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -7,7 +7,7 @@ var (
 		Name: "",
 		Type:    Nav},
 		Desc: "Top level catalog",
-		Entries: []string{"all"}}
+		Entries: []string{"all","recent","updated","authors","shelves"}}
 	AllFeed OpdsFeedDB = OpdsFeedDB{OpdsCommon: &OpdsCommon{
 		Id:    "urn:uuid:" + Uuidgen(),
 		Title: "All Books",
@@ -15,4 +15,34 @@ var (
 		Type: Acq},
 		Desc: "All books",
 		Sort: SortTitle}
+	AuthorsFeed OpdsFeedDB = OpdsFeedDB{OpdsCommon: &OpdsCommon{
+		Id:    "urn:uuid:" + Uuidgen(),
+		Title: "Authors",
+		Name: "authors",
+		Type: AuthorIndex},
+		Desc: "Books by author",
+		Sort: SortTitle}
+	RecentFeed OpdsFeedDB = OpdsFeedDB{OpdsCommon: &OpdsCommon{
+		Id:    "urn:uuid:" + Uuidgen(),
+		Title: "Recently Added",
+		Name: "recent",
+		Type: Acq},
+		Desc: "New arrivals",
+		Sort: SortAdded,
+		Window: 30}
+	UpdatedFeed OpdsFeedDB = OpdsFeedDB{OpdsCommon: &OpdsCommon{
+		Id:    "urn:uuid:" + Uuidgen(),
+		Title: "Recently Updated",
+		Name: "updated",
+		Type: Acq},
+		Desc: "Books with new files or metadata",
+		Sort: SortUpdated,
+		Window: 30}
+	ShelvesFeed OpdsFeedDB = OpdsFeedDB{OpdsCommon: &OpdsCommon{
+		Id:    "urn:uuid:" + Uuidgen(),
+		Title: "My Shelves",
+		Name: "shelves",
+		Type: Shelves},
+		Desc: "Your reading lists",
+		Sort: SortOrder}
 )
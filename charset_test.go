@@ -0,0 +1,46 @@
+package gopds
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCharsetReader(t *testing.T) {
+	tests := []struct {
+		charset, in, want string
+	}{
+		{"UTF-8", "Пикник", "Пикник"},
+		{"windows-1251", "\xcf\xe8\xea\xed\xe8\xea", "Пикник"},
+		{"CP1251", "\xcf\xe8\xea\xed\xe8\xea", "Пикник"},
+		{"koi8-r", "\xf0\xc9\xcb\xce\xc9\xcb", "Пикник"},
+		{"windows-1252", "Caf\xe9 \x9cuvre \x80", "Café œuvre €"},
+		{"ISO-8859-1", "Caf\xe9", "Café"},
+		{"latin1", "plain ascii", "plain ascii"},
+	}
+	for _, tt := range tests {
+		r, err := CharsetReader(tt.charset, strings.NewReader(tt.in))
+		if err != nil {
+			t.Errorf("CharsetReader(%q): %s", tt.charset, err)
+			continue
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("CharsetReader(%q) read %q, %v, want %q", tt.charset, got, err, tt.want)
+		}
+		if tt.charset != "UTF-8" {
+			if got := DecodeString(tt.charset, tt.in); got != tt.want {
+				t.Errorf("DecodeString(%q) = %q, want %q", tt.charset, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestCharsetReaderUnknown(t *testing.T) {
+	if _, err := CharsetReader("x-mac-klingon", strings.NewReader("")); err == nil {
+		t.Error("CharsetReader accepted an unknown charset")
+	}
+	if got := DecodeString("x-mac-klingon", "Caf\xe9"); got != "Caf\xe9" {
+		t.Errorf("DecodeString changed %q", got)
+	}
+}
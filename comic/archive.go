@@ -0,0 +1,208 @@
+package comic
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var (
+	unrar    string = "unrar"
+	sevenZip string = "7z"
+)
+
+// archive is the read-only view of a comic container shared by the zip
+// reader and the external rar/7z extractors.
+type archive interface {
+	Names() []string
+	Open(name string) (io.ReadCloser, error)
+	Close() error
+}
+
+type zipArchive struct {
+	file *zip.ReadCloser
+}
+
+func openZip(path string) (archive, error) {
+	file, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	return &zipArchive{file}, nil
+}
+
+func (arc *zipArchive) Names() []string {
+	names := make([]string, 0, len(arc.file.File))
+	for _, v := range arc.file.File {
+		if !strings.HasSuffix(v.Name, "/") {
+			names = append(names, v.Name)
+		}
+	}
+	return names
+}
+
+func (arc *zipArchive) Open(name string) (io.ReadCloser, error) {
+	for _, v := range arc.file.File {
+		if v.Name == name {
+			return v.Open()
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func (arc *zipArchive) Close() error {
+	return arc.file.Close()
+}
+
+// dirArchive is an archive that has been unpacked into a temporary
+// directory by an external tool.
+type dirArchive struct {
+	dir   string
+	names []string
+}
+
+func extract(path string, cmd func(src, dst string) *exec.Cmd) (archive, error) {
+	dir, err := ioutil.TempDir("", "gopds-comic")
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd(path, dir).CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, errors.New("Extracting " + path + ": " + err.Error() + ": " + string(out))
+	}
+	arc := &dirArchive{dir: dir}
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			arc.names = append(arc.names, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		arc.Close()
+		return nil, err
+	}
+	return arc, nil
+}
+
+func openRar(path string) (archive, error) {
+	return extract(path, func(src, dst string) *exec.Cmd {
+		return exec.Command(unrar, "x", "-o+", "-inul", src, dst+string(filepath.Separator))
+	})
+}
+
+func open7z(path string) (archive, error) {
+	return extract(path, func(src, dst string) *exec.Cmd {
+		return exec.Command(sevenZip, "x", "-y", "-o"+dst, src)
+	})
+}
+
+func (arc *dirArchive) Names() []string {
+	return arc.names
+}
+
+func (arc *dirArchive) Open(name string) (io.ReadCloser, error) {
+	for _, v := range arc.names {
+		if v == name {
+			return os.Open(filepath.Join(arc.dir, filepath.FromSlash(name)))
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func (arc *dirArchive) Close() error {
+	return os.RemoveAll(arc.dir)
+}
+
+func isImage(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp":
+		return !strings.HasPrefix(filepath.Base(name), ".")
+	}
+	return false
+}
+
+func imageType(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	case ".bmp":
+		return "image/bmp"
+	}
+	return ""
+}
+
+// pageNames returns the images in arc in reading order.
+func pageNames(arc archive) []string {
+	pages := []string{}
+	for _, v := range arc.Names() {
+		if isImage(v) {
+			pages = append(pages, v)
+		}
+	}
+	sort.Sort(naturalOrder(pages))
+	return pages
+}
+
+// naturalOrder sorts names so that runs of digits compare numerically,
+// putting "page2.jpg" before "page10.jpg".
+type naturalOrder []string
+
+func (s naturalOrder) Len() int      { return len(s) }
+func (s naturalOrder) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s naturalOrder) Less(i, j int) bool {
+	a, b := strings.ToLower(s[i]), strings.ToLower(s[j])
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			na, ra := splitDigits(a)
+			nb, rb := splitDigits(b)
+			na = strings.TrimLeft(na, "0")
+			nb = strings.TrimLeft(nb, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = ra, rb
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool {
+	return c < 0x80 && unicode.IsDigit(rune(c))
+}
+
+func splitDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
@@ -0,0 +1,49 @@
+package comic
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNaturalOrder(t *testing.T) {
+	tests := []struct {
+		in, want []string
+	}{
+		{[]string{"page10.jpg", "page2.jpg", "page1.jpg"},
+			[]string{"page1.jpg", "page2.jpg", "page10.jpg"}},
+		{[]string{"010.png", "9.png", "0011.png"},
+			[]string{"9.png", "010.png", "0011.png"}},
+		{[]string{"B/01.jpg", "a/02.jpg", "a/10.jpg"},
+			[]string{"a/02.jpg", "a/10.jpg", "B/01.jpg"}},
+		{[]string{"ch2/p1.jpg", "ch10/p1.jpg", "ch1/p12.jpg", "ch1/p3.jpg"},
+			[]string{"ch1/p3.jpg", "ch1/p12.jpg", "ch2/p1.jpg", "ch10/p1.jpg"}},
+		{[]string{"cover.jpg", "cover1.jpg", "cover.jpeg"},
+			[]string{"cover.jpeg", "cover.jpg", "cover1.jpg"}},
+	}
+	for _, tt := range tests {
+		got := append([]string{}, tt.in...)
+		sort.Sort(naturalOrder(got))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("naturalOrder(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsImage(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"p1.JPG", true},
+		{"dir/p1.webp", true},
+		{"ComicInfo.xml", false},
+		{"__MACOSX/._p1.jpg", false},
+		{"notes.txt", false},
+	}
+	for _, tt := range tests {
+		if got := isImage(tt.name); got != tt.want {
+			t.Errorf("isImage(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
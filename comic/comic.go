@@ -0,0 +1,185 @@
+package comic
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Pursuit92/gopds"
+)
+
+const (
+	CBZType = "application/vnd.comicbook+zip"
+	CBRType = "application/vnd.comicbook-rar"
+	CB7Type = "application/x-cb7"
+)
+
+type Comic struct {
+	path string
+	arc  archive
+	*ComicInfo
+	BookType string
+	Pages    []string
+	cover    string
+}
+
+func ReadCBZ(path string) (gopds.Ebook, error) {
+	return readComic(path, CBZType, openZip)
+}
+
+func ReadCBR(path string) (gopds.Ebook, error) {
+	return readComic(path, CBRType, openRar)
+}
+
+func ReadCB7(path string) (gopds.Ebook, error) {
+	return readComic(path, CB7Type, open7z)
+}
+
+func readComic(path, bookType string, open func(string) (archive, error)) (*Comic, error) {
+	safePath := filepath.FromSlash(path)
+	arc, err := open(safePath)
+	if err != nil {
+		return nil, err
+	}
+	book := &Comic{path: safePath, arc: arc, BookType: bookType}
+	book.Pages = pageNames(arc)
+	if len(book.Pages) == 0 {
+		arc.Close()
+		return nil, errors.New("No pages found in " + path)
+	}
+	err = book.readComicInfo()
+	if err != nil {
+		arc.Close()
+		return nil, err
+	}
+	book.cover = book.coverPage()
+	return book, nil
+}
+
+func (book *Comic) readComicInfo() error {
+	book.ComicInfo = &ComicInfo{}
+	for _, v := range book.arc.Names() {
+		if strings.EqualFold(filepath.Base(v), "ComicInfo.xml") {
+			rc, err := book.arc.Open(v)
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			return xml.NewDecoder(rc).Decode(book.ComicInfo)
+		}
+	}
+	return nil
+}
+
+// coverPage honours a FrontCover page in ComicInfo.xml and otherwise uses
+// the first image of the archive.
+func (book *Comic) coverPage() string {
+	for _, v := range book.ComicInfo.Pages {
+		if v.Type == "FrontCover" && v.Image >= 0 && v.Image < len(book.Pages) {
+			return book.Pages[v.Image]
+		}
+	}
+	return book.Pages[0]
+}
+
+func (book Comic) Cover() io.ReadCloser {
+	rc, _ := book.arc.Open(book.cover)
+	return rc
+}
+
+// Thumb returns nil: the server makes thumbnails from the cover.
+func (book Comic) Thumb() io.ReadCloser {
+	return nil
+}
+
+func (book Comic) Book() io.ReadCloser {
+	file, _ := os.Open(book.path)
+	return file
+}
+
+func (book Comic) OpdsMeta() *gopds.OpdsMeta {
+	info := book.ComicInfo
+	meta := &gopds.OpdsMeta{Title: info.Title,
+		Publisher: info.Publisher,
+		Issued:    info.issued(),
+		Lang:      info.LanguageISO,
+		Summary:   info.Summary,
+		Subjects:  splitNames(info.Genre),
+		Category:  info.Genre,
+		Series:    info.Series,
+		Pages:     len(book.Pages),
+		BookType:  book.BookType,
+		Cover:     true,
+		CoverType: imageType(book.cover)}
+
+	if info.Series != "" {
+		meta.SeriesIndex, _ = strconv.ParseFloat(info.Number, 64)
+	}
+	if meta.Title == "" {
+		meta.Title = info.defaultTitle(book.path)
+	}
+
+	for _, v := range splitNames(info.Writer) {
+		meta.Authors = append(meta.Authors, &gopds.OpdsAuthor{Name: v, Role: "aut"})
+	}
+	for _, credit := range []struct{ names, role string }{
+		{info.Penciller, "ill"},
+		{info.Inker, "art"},
+		{info.Colorist, "clr"},
+		{info.Letterer, "ctb"},
+		{info.CoverArtist, "cov"},
+		{info.Editor, "edt"}} {
+		for _, v := range splitNames(credit.names) {
+			meta.Contributors = append(meta.Contributors, &gopds.OpdsAuthor{Name: v, Role: credit.role})
+		}
+	}
+	// Art-only books are credited to their artist.
+	if len(meta.Authors) == 0 && len(meta.Contributors) > 0 {
+		meta.Authors = meta.Contributors[:1]
+	}
+	return meta
+}
+
+// splitNames splits the comma separated credit lists of ComicInfo.xml.
+func splitNames(names string) []string {
+	out := []string{}
+	for _, v := range strings.Split(names, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (info *ComicInfo) issued() string {
+	switch {
+	case info.Year == 0:
+		return ""
+	case info.Month == 0:
+		return fmt.Sprintf("%04d", info.Year)
+	case info.Day == 0:
+		return fmt.Sprintf("%04d-%02d", info.Year, info.Month)
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", info.Year, info.Month, info.Day)
+}
+
+func (info *ComicInfo) defaultTitle(path string) string {
+	if info.Series != "" {
+		if info.Number != "" {
+			return info.Series + " #" + info.Number
+		}
+		return info.Series
+	}
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func (book *Comic) Close() {
+	book.arc.Close()
+	os.Remove(book.path)
+}
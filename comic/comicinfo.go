@@ -0,0 +1,32 @@
+package comic
+
+import "encoding/xml"
+
+type ComicInfo struct {
+	XMLName     xml.Name `xml:"ComicInfo"`
+	Title       string   `xml:"Title"`
+	Series      string   `xml:"Series"`
+	Number      string   `xml:"Number"`
+	Volume      string   `xml:"Volume"`
+	Summary     string   `xml:"Summary"`
+	Year        int      `xml:"Year"`
+	Month       int      `xml:"Month"`
+	Day         int      `xml:"Day"`
+	Writer      string   `xml:"Writer"`
+	Penciller   string   `xml:"Penciller"`
+	Inker       string   `xml:"Inker"`
+	Colorist    string   `xml:"Colorist"`
+	Letterer    string   `xml:"Letterer"`
+	CoverArtist string   `xml:"CoverArtist"`
+	Editor      string   `xml:"Editor"`
+	Publisher   string   `xml:"Publisher"`
+	Genre       string   `xml:"Genre"`
+	LanguageISO string   `xml:"LanguageISO"`
+	PageCount   int      `xml:"PageCount"`
+	Pages       []Page   `xml:"Pages>Page"`
+}
+
+type Page struct {
+	Image int    `xml:"Image,attr"`
+	Type  string `xml:"Type,attr,omitempty"`
+}
@@ -0,0 +1,50 @@
+package comic
+
+import (
+	"io"
+
+	"github.com/Pursuit92/gopds"
+)
+
+// pager streams the pages of a stored comic without taking ownership of
+// the file the way Comic does.
+type pager struct {
+	arc   archive
+	pages []string
+}
+
+func OpenCBZPages(path string) (gopds.Pager, error) {
+	return openPager(path, openZip)
+}
+
+func OpenCBRPages(path string) (gopds.Pager, error) {
+	return openPager(path, openRar)
+}
+
+func OpenCB7Pages(path string) (gopds.Pager, error) {
+	return openPager(path, open7z)
+}
+
+func openPager(path string, open func(string) (archive, error)) (gopds.Pager, error) {
+	arc, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &pager{arc, pageNames(arc)}, nil
+}
+
+func (p *pager) PageCount() int {
+	return len(p.pages)
+}
+
+func (p *pager) Page(n int) (io.ReadCloser, string, error) {
+	rc, err := p.arc.Open(p.pages[n])
+	if err != nil {
+		return nil, "", err
+	}
+	return rc, imageType(p.pages[n]), nil
+}
+
+func (p *pager) Close() {
+	p.arc.Close()
+}
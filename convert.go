@@ -0,0 +1,136 @@
+package gopds
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Conversion produces another format of a stored book when it is
+// downloaded. Results are cached until the book changes.
+type Conversion struct {
+	// Name identifies the conversion in download URLs and cache files.
+	Name string
+	// MIME types of the stored book and of the result.
+	From, To string
+	// Extension of the downloaded file, including the dot.
+	Ext string
+	// Convert writes the book stored at path, whose catalog metadata is
+	// meta, to out.
+	Convert func(path string, meta *OpdsMeta, out io.Writer) error
+}
+
+// AddConversion advertises c as an extra acquisition link on books it
+// can convert.
+func (srv *Server) AddConversion(c Conversion) {
+	srv.conversions = append(srv.conversions, c)
+}
+
+func (srv *Server) createConvertLinks(entry *OpdsEntry) {
+	bookType := entry.bookType()
+	id := strings.TrimPrefix(entry.Id, "urn:uuid:")
+	for _, v := range srv.conversions {
+		if v.From == bookType {
+			entry.Links = append(entry.Links, &OpdsLink{Rel: "http://opds-spec.org/acquisition",
+				Type: v.To,
+				Href: "/convert/" + id + "/" + v.Name})
+		}
+	}
+}
+
+// conversion finds the named conversion of books of type from. Several
+// source types may share a name.
+func (srv *Server) conversion(name, from string) (Conversion, bool) {
+	for _, v := range srv.conversions {
+		if v.Name == name && v.From == from {
+			return v, true
+		}
+	}
+	return Conversion{}, false
+}
+
+// Converted returns the path of book id converted by the named
+// conversion, running it if there is no cached copy.
+func (srv *Server) Converted(id, name string) (string, *OpdsEntry, error) {
+	book := &OpdsEntry{}
+	err := srv.DB.Get("books", id, book)
+	if err != nil {
+		return "", nil, err
+	}
+	c, ok := srv.conversion(name, book.bookType())
+	if !ok {
+		return "", nil, os.ErrNotExist
+	}
+	cacheDir := filepath.FromSlash(srv.Files + "/cache")
+	cached := filepath.Join(cacheDir, id+"."+c.Name)
+	if _, err := os.Stat(cached); err == nil {
+		return cached, book, nil
+	}
+	// data directories made before conversions have no cache
+	err = os.MkdirAll(cacheDir, os.ModeDir|0777)
+	if err != nil {
+		return "", nil, err
+	}
+	// Convert to a temporary name first so concurrent downloads never see
+	// a partial file.
+	tmp := cached + "." + Uuidgen()
+	file, err := os.Create(tmp)
+	if err != nil {
+		return "", nil, err
+	}
+	err = c.Convert(filepath.FromSlash(srv.Files+"/books/"+id), book.OpdsMeta, file)
+	file.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return "", nil, err
+	}
+	return cached, book, os.Rename(tmp, cached)
+}
+
+func (srv *Server) clearConversions(id string) {
+	cached, _ := filepath.Glob(filepath.FromSlash(srv.Files + "/cache/" + id + ".*"))
+	for _, v := range cached {
+		os.Remove(v)
+	}
+}
+
+// downloadName is a file name for a book built from its title.
+func downloadName(title, ext string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, title)
+	if name == "" {
+		name = "book"
+	}
+	return name + ext
+}
+
+func (srv *Server) handleConvert(w http.ResponseWriter, r *http.Request) {
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) < 3 || components[1] == "" {
+		http.Error(w, "Must give book uuid and format", 404)
+		return
+	}
+	id, name := components[1], components[2]
+	path, book, err := srv.Converted(id, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Not found", 404)
+		} else {
+			http.Error(w, err.Error(), 500)
+		}
+		return
+	}
+	c, _ := srv.conversion(name, book.bookType())
+	srv.recordDownload(r, id, c.To)
+	w.Header().Set("Content-Type", c.To)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": downloadName(book.Title, c.Ext)}))
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,54 @@
+package gopds
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConverted(t *testing.T) {
+	srv := newTestServer(t)
+	// data directories from before conversions have no cache
+	if err := os.RemoveAll(filepath.Join(srv.Files, "cache")); err != nil {
+		t.Fatal(err)
+	}
+	runs := 0
+	srv.AddConversion(Conversion{Name: "upper", From: "text/plain", To: "text/plain", Ext: ".txt",
+		Convert: func(path string, meta *OpdsMeta, out io.Writer) error {
+			runs++
+			data, err := ioutil.ReadFile(path)
+			if err == nil {
+				_, err = io.WriteString(out, meta.Title+": "+strings.ToUpper(string(data)))
+			}
+			return err
+		}})
+	storeTestBook(t, srv, "book", "hello")
+	meta := &OpdsMeta{Title: "Greeting", BookType: "text/plain"}
+	if err := srv.updateBookDB("book", meta); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		path, book, err := srv.Converted("book", "upper")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadFile(path)
+		if string(data) != "Greeting: HELLO" || book.Title != "Greeting" {
+			t.Errorf("converted %q from %q", data, book.Title)
+		}
+	}
+	if runs != 1 {
+		t.Errorf("converted %d times, want once then cached", runs)
+	}
+	if _, _, err := srv.Converted("book", "kepub"); err == nil {
+		t.Error("ran a conversion that doesn't exist")
+	}
+	srv.clearConversions("book")
+	if cached, _ := filepath.Glob(filepath.Join(srv.Files, "cache", "book.*")); len(cached) != 0 {
+		t.Errorf("left %v", cached)
+	}
+}
@@ -14,7 +14,7 @@ func (srv *Server) initDB() error {
 		return err
 	}
 	if !exists {
-		err := db.Set("nav", "root", RootFeed)
+		err := srv.setFeed("root", &RootFeed)
 		if err != nil {
 			return err
 		}
@@ -24,28 +24,98 @@ func (srv *Server) initDB() error {
 		return err
 	}
 	if !exists {
-		err = db.Set("nav", "all", AllFeed)
+		err = srv.setFeed("all", &AllFeed)
 		if err != nil {
 			return err
 		}
 	}
+	for _,v := range []*OpdsFeedDB{&AuthorsFeed,&ShelvesFeed,&RecentFeed,&UpdatedFeed} {
+		err = srv.addRootFeed(v)
+		if err != nil {
+			return err
+		}
+	}
+	// open the account databases now rather than racing to do it from
+	// concurrent requests
+	for _,v := range []string{"users","tokens","progress","status","downloads","partialmd5"} {
+		_,err = db.GetDB(v)
+		if err != nil {
+			return err
+		}
+	}
+	err = srv.upgradeFeeds()
+	if err != nil {
+		return err
+	}
+	return srv.upgradeBooks()
+}
+
+// addRootFeed stores feed if it is missing, linking it from the root
+// feed of catalogs created before it existed.
+func (srv *Server) addRootFeed(feed *OpdsFeedDB) error {
+	db := srv.DB
+	exists, err := db.Exists("nav", feed.Name)
+	if err != nil || exists {
+		return err
+	}
+	err = srv.setFeed(feed.Name, feed)
+	if err != nil {
+		return err
+	}
+	root := &OpdsFeedDB{}
+	err = db.Get("nav", "root", root)
+	if err != nil {
+		return err
+	}
+	if root.Entries != nil && !containsString(root.Entries, feed.Name) {
+		root.Entries = append(root.Entries, feed.Name)
+		return srv.setFeed("root", root)
+	}
 	return nil
 }
 
-func (srv *Server) getFeedDB(name string,sortString string) (*OpdsFeed, error) {
+func (srv *Server) getFeedDB(req *FeedRequest) (*OpdsFeed, error) {
 	db := srv.DB
-	var err error
+	name,sortString := req.Name,req.Sort
+	acc,err := srv.accessFor(req.User)
+	if err != nil {
+		return nil,err
+	}
+	// shelves belong to users
+	if req.User == nil {
+		acc.hiddenFeeds[ShelvesFeed.Name] = true
+	}
 	dbFeed := &OpdsFeedDB{}
+	// what a search feed, or a feed that wasn't found, searches for
+	query := name
 	if len(name) >= 7 && name[:7] == "search:" {
+		query = name[7:]
 		dbFeed = &OpdsFeedDB{OpdsCommon: &OpdsCommon{
 			Id: "urn:uuid:" + Uuidgen(),
 			Type: Search,
 			Title: "Search Results"},
 			Desc: "Search: " + name[7:],
 			Sort: SortOrder}
+	} else if _,ok := personalFeeds[name]; ok {
+		dbFeed,err = srv.getPersonalFeed(name,req.User)
+		if err != nil {
+			return nil,err
+		}
+	} else if len(name) >= 7 && name[:7] == "author:" {
+		dbFeed = &OpdsFeedDB{OpdsCommon: &OpdsCommon{
+			Id: "urn:uuid:" + Uuidgen(),
+			Type: Acq,
+			Title: name[7:]},
+			Desc: "Books by " + name[7:],
+			Sort: SortSeries}
+		dbFeed.Entries,err = srv.authorBooks(name[7:])
+		if err != nil {
+			return nil,err
+		}
 	} else {
 		err = db.Get("nav", name, dbFeed)
-		if err != nil {
+		// hidden feeds look just like missing ones
+		if err != nil || acc.hiddenFeeds[name] {
 			dbFeed = &OpdsFeedDB{OpdsCommon: &OpdsCommon{
 				Id: "urn:uuid:" + Uuidgen(),
 				Type: Search,
@@ -56,29 +126,49 @@ func (srv *Server) getFeedDB(name string,sortString string) (*OpdsFeed, error) {
 	}
 
 	feed := &OpdsFeed{OpdsCommon: dbFeed.OpdsCommon,
-	XmlNs: "http://www.w3.org/2005/Atom"}
+	XmlNs: "http://www.w3.org/2005/Atom",
+	XmlNsPse: PseNs}
 
 	sortFun := sortFuncBytes[dbFeed.Sort]
-	if sortString != "" && dbFeed.Type != Search {
+	if sortString != "" && (dbFeed.Type == Nav || dbFeed.Type == Acq) {
 		sortFun = sortFuncStrings[sortString]
 	}
 
 	switch dbFeed.Type {
 	case Acq:
-		feed.Entries,err = srv.getAcqEntries(dbFeed.Entries)
+		if dbFeed.Query != "" {
+			feed.Entries,err = srv.Search(dbFeed.Query)
+		} else {
+			feed.Entries,err = srv.getAcqEntries(dbFeed.Entries)
+		}
 	case Nav:
 		feed.Entries,err = srv.getNavEntries(dbFeed.Entries)
+	case AuthorIndex:
+		feed.Entries,err = srv.getAuthorEntries(acc)
+	case Shelves:
+		feed.Entries,err = srv.getShelfEntries(req.User,acc)
 	default:
-		feed.Entries,err = srv.Search(name[7:])
+		feed.Entries,err = srv.Search(query)
+	}
+
+	feed.Entries = acc.filter(feed.Entries,dbFeed.Type)
+	if dbFeed.Window > 0 {
+		windowEntries(feed,dbFeed)
 	}
 
 	// add links to the feed
-	createFeedLinks(feed,name)
+	parent := "root"
+	if dbFeed.Type != Search {
+		parent = feedParent(name,dbFeed)
+	}
+	feed.Crumbs = srv.feedCrumbs(parent,acc)
+	createFeedLinks(feed,req)
 	addSearchLink(feed)
 
 	// Sort and paginate
 	sorter := NewEntrySorter(feed.Entries,sortFun)
 	sort.Sort(sorter)
+	paginate(feed,req)
 
 	return feed, err
 }
@@ -106,8 +196,11 @@ func (srv *Server) getAcqEntries(ents []string) ([]*OpdsEntry,error) {
 			entries[i] = &OpdsEntry{}
 			err := db.Get("books",v,entries[i])
 			if err == nil {
+				// keep the listed order for feeds sorted by it
+				entries[i].Order = i
 				n++
 			} else {
+				entries[i] = nil
 				log.Print("Error: "+err.Error())
 			}
 		}
@@ -125,13 +218,24 @@ func (srv *Server) getAcqEntries(ents []string) ([]*OpdsEntry,error) {
 	}
 
 	for _,v := range entries {
-		createAcqLinks(v)
+		srv.createBookLinks(v)
 		v.Id = "urn:uuid:" + v.Id
 	}
 
 	return entries,nil
 }
 
+// createBookLinks adds the links and content shown with a book entry.
+func (srv *Server) createBookLinks(v *OpdsEntry) {
+	createAcqLinks(v)
+	srv.createConvertLinks(v)
+	srv.createStreamLink(v)
+	addAuthorLinks(v)
+	createTocContent(v)
+	createCategories(v)
+	createEntryLink(v)
+}
+
 func (srv *Server) getNavEntries(ents []string) ([]*OpdsEntry,error) {
 	db := srv.DB
 	var entries []*OpdsEntry
@@ -158,6 +262,8 @@ func (srv *Server) getNavEntries(ents []string) ([]*OpdsEntry,error) {
 			if err == nil {
 				n++
 			} else {
+				feeds[i] = nil
+				log.Print("Error: "+v+": "+err.Error())
 			}
 		}
 		if n != len(ents) {
@@ -176,7 +282,7 @@ func (srv *Server) getNavEntries(ents []string) ([]*OpdsEntry,error) {
 	entries = make([]*OpdsEntry,len(feeds))
 	for i,v := range feeds {
 		entries[i] = feedToEntry(v)
-		createNavLinks(entries[i])
+		createNavLinks(entries[i],v.Type)
 		entries[i].Id = "urn:uuid:" + entries[i].Id
 	}
 
@@ -189,6 +295,13 @@ func (srv *Server) updateBookDB(uuid string, meta *OpdsMeta) error {
 	entry.OpdsMeta = meta
 	entry.Id = uuid
 	entry.Updated = time.Now().Format(time.RFC3339)
+	old := &OpdsEntry{}
+	if db.Get("books", uuid, old) == nil {
+		entry.Added = old.Added
+	}
+	if entry.Added == "" {
+		entry.Added = entry.Updated
+	}
 	err := db.Set("books", entry.Id, entry)
 	if err != nil {
 		return err
@@ -5,6 +5,8 @@ import "io"
 type Ebook interface {
 	OpdsMeta() *OpdsMeta
 	Cover() io.ReadCloser
+	// Thumb is no longer used, the server makes thumbnails from Cover in
+	// the configured size and format. Implementations may return nil.
 	Thumb() io.ReadCloser
 	Book() io.ReadCloser
 	Close()
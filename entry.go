@@ -0,0 +1,121 @@
+package gopds
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// EntryType is the link type of complete OPDS entry documents.
+const EntryType = "application/atom+xml;type=entry;profile=opds-catalog"
+
+// OpdsEntryDoc is a book's complete entry as a standalone document.
+type OpdsEntryDoc struct {
+	XMLName  xml.Name `xml:"entry"`
+	XmlNs    string   `xml:"xmlns,attr,omitempty"`
+	XmlNsPse string   `xml:"xmlns:pse,attr,omitempty"`
+	*OpdsEntry
+}
+
+// entryHref is the address of the complete entry of book id.
+func entryHref(id string) string {
+	return "/book?id=" + id
+}
+
+// identifierURN writes identifiers with a URN scheme as URNs, leaving the
+// ones already in that form and the rest alone.
+func identifierURN(ident *OpdsIdentifier) *OpdsIdentifier {
+	value := ident.Value
+	if strings.HasPrefix(strings.ToLower(value), "urn:") {
+		return ident
+	}
+	switch strings.ToLower(ident.Scheme) {
+	case "isbn":
+		value = "urn:isbn:" + strings.Replace(value, "-", "", -1)
+	case "uuid":
+		value = "urn:uuid:" + value
+	case "doi":
+		value = "urn:doi:" + value
+	default:
+		return ident
+	}
+	return &OpdsIdentifier{Scheme: ident.Scheme, Value: value}
+}
+
+// createRelatedLinks links the feeds of a book's authors and series.
+func createRelatedLinks(entry *OpdsEntry) {
+	for _, v := range entry.Authors {
+		if v.Name == "" {
+			continue
+		}
+		entry.Links = append(entry.Links, &OpdsLink{Rel: "related",
+			Href:  "/catalog/" + url.PathEscape(authorFeedName(v.Name)),
+			Type:  kindType(Acq),
+			Title: "Books by " + v.Name})
+	}
+	if entry.Series != "" {
+		entry.Links = append(entry.Links, &OpdsLink{Rel: "related",
+			Href:  "/search?q=" + url.QueryEscape(fmt.Sprintf("series:%q", entry.Series)),
+			Type:  kindType(Search),
+			Title: "More of " + entry.Series})
+	}
+}
+
+// completeEntry builds the complete entry of book id, which partial
+// entries in feeds link to as their alternate.
+func (srv *Server) completeEntry(id string) (*OpdsEntryDoc, error) {
+	book := &OpdsEntry{}
+	err := srv.DB.Get("books", id, book)
+	if err != nil {
+		return nil, err
+	}
+	srv.createBookLinks(book)
+	// the same id as the book's partial entries
+	book.Id = "urn:uuid:" + book.Id
+	for _, v := range book.Links {
+		if v.Rel == "alternate" && v.Type == EntryType {
+			v.Rel = "self"
+		}
+	}
+	createRelatedLinks(book)
+	idents := []*OpdsIdentifier{}
+	for _, v := range book.Identifiers {
+		idents = append(idents, identifierURN(v))
+	}
+	book.Identifiers = idents
+	return &OpdsEntryDoc{XmlNs: "http://www.w3.org/2005/Atom",
+		XmlNsPse:  PseNs,
+		OpdsEntry: book}, nil
+}
+
+// handleEntry serves the book given by the id parameter, as its complete
+// entry to OPDS clients and as a page to browsers.
+func (srv *Server) handleEntry(w http.ResponseWriter, r *http.Request) {
+	if wantsHTML(r) {
+		srv.handleBookPage(w, r)
+		return
+	}
+	id := r.FormValue("id")
+	if id == "" {
+		http.Error(w, "Book not found", 404)
+		return
+	}
+	srv.Mut.Lock()
+	entry, err := srv.completeEntry(id)
+	srv.Mut.Unlock()
+	if err != nil {
+		http.Error(w, "Book not found", 404)
+		return
+	}
+	out, err := xmlMarshaler(entry, "", "  ")
+	if err != nil {
+		log.Printf("Error: writing entry %s: %s", id, err.Error())
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", EntryType)
+	w.Write(out)
+}
@@ -0,0 +1,166 @@
+package epub
+
+import (
+	"encoding/xml"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// findCover locates the cover image the way reading systems do: the EPUB 3
+// cover-image manifest property, then the EPUB 2 cover meta, then the
+// guide's cover page. A manifest item simply named "cover" is the last
+// resort.
+func (book *Epub) findCover() {
+	r := book.Renditions[0]
+	item := r.propertyItem("cover-image")
+	if item == nil {
+		for _, v := range r.Meta.Metas {
+			if v.Name == "cover" {
+				item = r.itemById(v.Content)
+				if item == nil {
+					item = r.itemByPath(r.Resolve(v.Content))
+				}
+				break
+			}
+		}
+	}
+	if item != nil && isImage(item.MediaType) {
+		book.setCover(r.Resolve(item.Href), item.MediaType)
+		if book.HasCover {
+			return
+		}
+	}
+	for _, v := range r.Guide {
+		if strings.EqualFold(v.Type, "cover") {
+			book.setCover(book.coverFromPage(r, r.Resolve(v.Href)))
+			if book.HasCover {
+				return
+			}
+		}
+	}
+	for _, id := range []string{"cover", "cover-image", "coverimage"} {
+		item = r.itemById(id)
+		if item != nil && isImage(item.MediaType) {
+			book.setCover(r.Resolve(item.Href), item.MediaType)
+			if book.HasCover {
+				return
+			}
+		}
+	}
+}
+
+func (book *Epub) setCover(name, mediaType string) {
+	if name == "" || book.zipFile(name) == nil {
+		return
+	}
+	book.coverPath = name
+	book.CoverType = mediaType
+	book.HasCover = true
+}
+
+// coverFromPage returns the first image referenced by a cover page. Guide
+// references sometimes point straight at the image instead.
+func (book *Epub) coverFromPage(r *Rendition, page string) (string, string) {
+	if item := r.itemByPath(page); item != nil && isImage(item.MediaType) {
+		return page, item.MediaType
+	}
+	f := book.zipFile(page)
+	if f == nil {
+		return "", ""
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "", ""
+	}
+	defer rc.Close()
+	dec := xml.NewDecoder(rc)
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", ""
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		var src string
+		switch se.Name.Local {
+		case "img":
+			src = attrValue(se, "src")
+		case "image":
+			src = attrValue(se, "href")
+		default:
+			continue
+		}
+		if src == "" {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(src); err == nil {
+			src = unescaped
+		}
+		name := resolve(path.Dir(page), src)
+		if item := r.itemByPath(name); item != nil && item.MediaType != "" {
+			return name, item.MediaType
+		}
+		return name, extType(name)
+	}
+}
+
+func (r *Rendition) itemById(id string) *Item {
+	for i, v := range r.Manifest {
+		if v.Id == id {
+			return &r.Manifest[i]
+		}
+	}
+	return nil
+}
+
+func (r *Rendition) itemByPath(name string) *Item {
+	for i, v := range r.Manifest {
+		if r.Resolve(v.Href) == name {
+			return &r.Manifest[i]
+		}
+	}
+	return nil
+}
+
+func (r *Rendition) propertyItem(property string) *Item {
+	for i, v := range r.Manifest {
+		for _, p := range strings.Fields(v.Properties) {
+			if p == property {
+				return &r.Manifest[i]
+			}
+		}
+	}
+	return nil
+}
+
+func isImage(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "image/")
+}
+
+func extType(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".svg":
+		return "image/svg+xml"
+	}
+	return ""
+}
+
+func attrValue(se xml.StartElement, name string) string {
+	for _, v := range se.Attr {
+		if v.Name.Local == name {
+			return v.Value
+		}
+	}
+	return ""
+}
@@ -5,24 +5,34 @@ import (
 	"encoding/xml"
 	"errors"
 	"io"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
+	"strings"
 
 	"github.com/Pursuit92/gopds"
 )
 
-var (
-	coverExp *regexp.Regexp = regexp.MustCompile(`.*([c,C]over|cvi).*\.(jpg|jpeg|png)`)
-	thumbExp *regexp.Regexp = regexp.MustCompile(`.*cvt.*\.(jpg|jpeg|png)`)
-)
+const containerPath = "META-INF/container.xml"
 
 type Epub struct {
 	path string
 	file *zip.ReadCloser
+	// The default rendition; the first rootfile in container.xml.
+	*Package
+	Renditions []*Rendition
+	HasCover   bool
+	CoverType  string
+	coverPath  string
+	problems   []Problem
+}
+
+// Rendition is one of the package documents listed in container.xml.
+type Rendition struct {
+	// Zip path of the OPF, which hrefs in the package are relative to.
+	Path string
 	*Package
-	HasCover, HasThumb   bool
-	ThumbType, CoverType string
 }
 
 func ReadEpub(path string) (gopds.Ebook, error) {
@@ -40,119 +50,147 @@ func readEpub(path string) (*Epub, error) {
 		}
 	}
 
-	book := &Epub{path: safePath, HasThumb: true, HasCover: true}
+	book, err := openEpub(safePath)
+	if err != nil {
+		return nil, err
+	}
+	book.problems = book.Validate()
+	if errs := fatal(book.problems); rejectInvalid && len(errs) > 0 {
+		book.file.Close()
+		return nil, formatError(safePath, strings.Join(errs, "; "), nil)
+	}
+	return book, nil
+}
+
+// openEpub reads an epub that needs no DRM removal.
+func openEpub(safePath string) (*Epub, error) {
+	book := &Epub{path: safePath}
 	// Open a zip archive for reading.
 	var err error
 	book.file, err = zip.OpenReader(safePath)
 	if err != nil {
-		return nil, err
+		return nil, formatError(safePath, "not a zip archive", err)
 	}
 	err = book.readOPF()
 	if err != nil {
+		book.file.Close()
 		return nil, err
 	}
-	book.CoverType, book.HasCover = book.coverTest()
-	book.ThumbType, book.HasThumb = book.thumbTest()
+	book.findCover()
 	return book, nil
 }
 
-func (book Epub) coverTest() (string, bool) {
-	for _, v := range book.file.File {
-		if coverExp.Match([]byte(v.Name)) {
-			_, err := v.Open()
-			if err == nil {
-				imgtype := ""
-				switch v.Name[len(v.Name)-4:] {
-				case ".jpg", "jpeg":
-					imgtype = "image/jpeg"
-				case ".png":
-					imgtype = "image/png"
-				}
-				return imgtype, true
-			}
-		}
+func (book Epub) Cover() io.ReadCloser {
+	return book.openFile(book.coverPath)
+}
+
+// Thumb returns nil: the server makes thumbnails from the cover.
+func (book Epub) Thumb() io.ReadCloser {
+	return nil
+}
+
+func (book Epub) openFile(name string) io.ReadCloser {
+	f := book.zipFile(name)
+	if f == nil {
+		return nil
 	}
-	return "", false
+	rc, _ := f.Open()
+	return rc
 }
 
-func (book Epub) thumbTest() (string, bool) {
-	for _, v := range book.file.File {
-		if thumbExp.Match([]byte(v.Name)) {
-			_, err := v.Open()
-			if err == nil {
-				imgtype := ""
-				switch v.Name[len(v.Name)-4:] {
-				case ".jpg", ".jpeg":
-					imgtype = "image/jpeg"
-				case ".png":
-					imgtype = "image/png"
-				}
-				return imgtype, true
-			}
+func (book Epub) Book() io.ReadCloser {
+	file, _ := os.Open(book.path)
+	return file
+}
+
+// readOPF locates the package documents through META-INF/container.xml
+// as the OCF spec requires.
+func (book *Epub) readOPF() error {
+	container := &Container{}
+	err := book.decodeFile(containerPath, container)
+	if err != nil {
+		return err
+	}
+	for _, v := range container.Rootfiles {
+		if v.MediaType != "" && v.MediaType != "application/oebps-package+xml" {
+			continue
 		}
+		opf := &Package{}
+		err = book.decodeFile(v.FullPath, opf)
+		if err != nil {
+			return err
+		}
+		opf.Meta.refine()
+		book.Renditions = append(book.Renditions, &Rendition{Path: v.FullPath, Package: opf})
+	}
+	if len(book.Renditions) == 0 {
+		return formatError(book.path, "no package document in "+containerPath, nil)
 	}
-	return "", false
+	book.Package = book.Renditions[0].Package
+	return nil
 }
 
-func (book Epub) Thumb() io.ReadCloser {
-	for _, v := range book.file.File {
-		if thumbExp.Match([]byte(v.Name)) {
-			file, _ := v.Open()
-			return file
-		}
+func (book *Epub) decodeFile(name string, v interface{}) error {
+	f := book.zipFile(name)
+	if f == nil {
+		return formatError(book.path, "missing "+name, nil)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return formatError(book.path, "unreadable "+name, err)
+	}
+	defer rc.Close()
+	err = xml.NewDecoder(rc).Decode(v)
+	if err != nil {
+		return formatError(book.path, "malformed "+name, err)
 	}
 	return nil
 }
 
-func (book Epub) Cover() io.ReadCloser {
+func (book *Epub) zipFile(name string) *zip.File {
 	for _, v := range book.file.File {
-		if coverExp.Match([]byte(v.Name)) {
-			file, _ := v.Open()
-			return file
+		if v.Name == name {
+			return v
 		}
 	}
 	return nil
 }
 
-func (book Epub) Book() io.ReadCloser {
-	file, _ := os.Open(book.path)
-	return file
+// resolveFile finds the archive entry an href in the default rendition
+// refers to.
+func (book *Epub) resolveFile(href string) *zip.File {
+	return book.zipFile(book.Renditions[0].Resolve(href))
 }
 
-func (book *Epub) readOPF() error {
-	// Iterate through the files in the archive,
-	for _, f := range book.file.File {
-		if f.Name[len(f.Name)-3:] == "opf" {
-			rc, err := f.Open()
-			if err != nil {
-				return err
-			}
-			defer rc.Close()
-			opf := &Package{}
-			err = xml.NewDecoder(rc).Decode(opf)
-			if err != nil {
-				return err
-			}
-			book.Package = opf
-			return nil
-		}
+// Resolve turns an href from the package document into a path within the
+// archive.
+func (r *Rendition) Resolve(href string) string {
+	if i := strings.IndexAny(href, "#?"); i >= 0 {
+		href = href[:i]
 	}
-	return nil
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	return resolve(path.Dir(r.Path), href)
+}
+
+func resolve(dir, href string) string {
+	if strings.HasPrefix(href, "/") {
+		return strings.TrimPrefix(path.Clean(href), "/")
+	}
+	return strings.TrimPrefix(path.Join(dir, href), "./")
 }
 
 func (book Epub) OpdsMeta() *gopds.OpdsMeta {
-	meta := book.Meta
-	return &gopds.OpdsMeta{Title: meta.Title,
-		Author:    &gopds.OpdsAuthor{Name: meta.Creator},
-		Publisher: meta.Publisher,
-		Issued:    meta.Date,
-		Lang:      meta.Language,
-		Summary:   meta.Description,
-		Rights:    meta.Rights,
+	meta := &gopds.OpdsMeta{BookType: "application/epub+zip",
 		Cover:     book.HasCover,
-		Thumb:     book.HasThumb,
-		CoverType: book.CoverType,
-		ThumbType: book.ThumbType}
+		CoverType: book.CoverType}
+	book.Meta.fill(meta)
+	meta.Toc = book.Toc()
+	for _, v := range book.problems {
+		meta.Warnings = append(meta.Warnings, v.String())
+	}
+	return meta
 }
 
 func (book *Epub) Close() {
@@ -0,0 +1,24 @@
+package epub
+
+// FormatError reports an archive that isn't a structurally valid epub.
+type FormatError struct {
+	Path   string
+	Reason string
+	Err    error
+}
+
+func (e *FormatError) Error() string {
+	msg := "epub: " + e.Path + ": " + e.Reason
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func formatError(path, reason string, err error) error {
+	return &FormatError{Path: path, Reason: reason, Err: err}
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
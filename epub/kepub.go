@@ -0,0 +1,172 @@
+package epub
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Pursuit92/gopds"
+)
+
+// KepubType is the MIME type Kobo devices use for kepub books.
+const KepubType = "application/kepub+zip"
+
+// A sentence ends at terminal punctuation, optionally followed by closing
+// quotes or brackets, and then whitespace.
+var sentenceExp *regexp.Regexp = regexp.MustCompile(`[.!?\x{2026}]+["'\x{201D}\x{2019})\]]*\s+`)
+
+// Elements that start a new kobo paragraph number.
+var koboBlocks = map[string]bool{
+	"p":          true,
+	"div":        true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"li":         true,
+	"blockquote": true,
+	"td":         true,
+	"dd":         true,
+	"dt":         true,
+	"pre":        true,
+}
+
+// ToKepub copies the epub at path to out with every sentence of the spine
+// documents wrapped in the koboSpan markup Kobo's reader uses for reading
+// statistics and page turns. The book keeps its own metadata, so meta is
+// unused. It is the Convert function of a gopds.Conversion.
+func ToKepub(path string, meta *gopds.OpdsMeta, out io.Writer) error {
+	book, err := openEpub(filepath.FromSlash(path))
+	if err != nil {
+		return err
+	}
+	defer book.file.Close()
+
+	spine := make(map[string]bool)
+	for _, r := range book.Renditions {
+		for _, v := range r.Spine.Itemrefs {
+			item := r.itemById(v.Idref)
+			if item != nil && item.MediaType == "application/xhtml+xml" {
+				spine[r.Resolve(item.Href)] = true
+			}
+		}
+	}
+
+	w, err := NewWriter(out)
+	if err != nil {
+		return err
+	}
+	for _, f := range book.file.File {
+		if f.Name == "mimetype" {
+			continue
+		}
+		if !spine[f.Name] {
+			err = w.Copy(f)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		raw, err := book.readFile(f.Name)
+		if err != nil {
+			return err
+		}
+		err = w.WriteFile(f.Name, koboSpans(raw))
+		if err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// koboSpans wraps the text of an XHTML document's body in koboSpan
+// elements numbered by paragraph and sentence. Documents that already
+// have spans, or that can't be parsed, are returned unchanged.
+func koboSpans(raw []byte) []byte {
+	if bytes.Contains(raw, []byte("koboSpan")) {
+		return raw
+	}
+	dec := xml.NewDecoder(bytes.NewReader(raw))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+
+	out := &bytes.Buffer{}
+	pos := int64(0)
+	body, skip := false, 0
+	para, seg := 0, 0
+	for {
+		off := dec.InputOffset()
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return raw
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			switch {
+			case name == "body":
+				body = true
+			case name == "script" || name == "style" || name == "svg" || name == "math":
+				skip++
+			case koboBlocks[name]:
+				para++
+				seg = 0
+			}
+		case xml.EndElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "body":
+				body = false
+			case "script", "style", "svg", "math":
+				if skip > 0 {
+					skip--
+				}
+			}
+		case xml.CharData:
+			end := dec.InputOffset()
+			text := raw[off:end]
+			if !body || skip > 0 || len(bytes.TrimSpace(t)) == 0 || bytes.HasPrefix(text, []byte("<![CDATA[")) {
+				continue
+			}
+			if para == 0 {
+				para = 1
+			}
+			out.Write(raw[pos:off])
+			for _, s := range sentences(string(text)) {
+				trimmed := strings.TrimRight(s, " \t\r\n")
+				if strings.TrimSpace(trimmed) == "" {
+					out.WriteString(s)
+					continue
+				}
+				seg++
+				fmt.Fprintf(out, `<span class="koboSpan" id="kobo.%d.%d">%s</span>%s`,
+					para, seg, trimmed, s[len(trimmed):])
+			}
+			pos = end
+		}
+	}
+	out.Write(raw[pos:])
+	return out.Bytes()
+}
+
+// sentences splits text after each sentence's trailing whitespace.
+func sentences(text string) []string {
+	out := []string{}
+	start := 0
+	for _, m := range sentenceExp.FindAllStringIndex(text, -1) {
+		out = append(out, text[start:m[1]])
+		start = m[1]
+	}
+	if start < len(text) {
+		out = append(out, text[start:])
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+package epub
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSentences(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"One.", []string{"One."}},
+		{"One. Two! Three?", []string{"One. ", "Two! ", "Three?"}},
+		{"\"Quoted.\" Then (aside.) end", []string{"\"Quoted.\" ", "Then (aside.) ", "end"}},
+		{"Wait… what?! ", []string{"Wait… ", "what?! "}},
+		{"no stop", []string{"no stop"}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		if got := sentences(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sentences(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestKoboSpans(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"paragraphs",
+			`<html><body><p>One. Two.</p><p>Three</p></body></html>`,
+			`<html><body><p><span class="koboSpan" id="kobo.1.1">One.</span> <span class="koboSpan" id="kobo.1.2">Two.</span></p><p><span class="koboSpan" id="kobo.2.1">Three</span></p></body></html>`},
+		{"inline markup",
+			`<body><p>A <em>b</em>. C</p></body>`,
+			`<body><p><span class="koboSpan" id="kobo.1.1">A</span> <em><span class="koboSpan" id="kobo.1.2">b</span></em><span class="koboSpan" id="kobo.1.3">.</span> <span class="koboSpan" id="kobo.1.4">C</span></p></body>`},
+		{"text outside blocks",
+			`<body>Loose text</body>`,
+			`<body><span class="koboSpan" id="kobo.1.1">Loose text</span></body>`},
+		{"head, scripts and whitespace",
+			"<html><head><title>T</title><style>p {}</style></head><body>\n<script>x()</script><p>A</p>\n</body></html>",
+			"<html><head><title>T</title><style>p {}</style></head><body>\n<script>x()</script><p><span class=\"koboSpan\" id=\"kobo.1.1\">A</span></p>\n</body></html>"},
+		{"entities",
+			`<body><p>Fish &amp; chips.</p></body>`,
+			`<body><p><span class="koboSpan" id="kobo.1.1">Fish &amp; chips.</span></p></body>`},
+		{"already converted",
+			`<body><p><span class="koboSpan" id="kobo.1.1">A</span></p></body>`,
+			`<body><p><span class="koboSpan" id="kobo.1.1">A</span></p></body>`},
+		{"unparseable",
+			`<body><p>A</p></body`,
+			`<body><p>A</p></body`},
+	}
+	for _, tt := range tests {
+		if got := string(koboSpans([]byte(tt.in))); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestToKepub(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "book.epub")
+	writeTestEpub(t, path, map[string]string{
+		"OEBPS/content.opf": testOPF,
+		"OEBPS/ch1.xhtml":   `<html><body><p>Call me Ishmael. Some years ago.</p></body></html>`,
+		"OEBPS/nav.xhtml":   `<html><body><nav><ol><li>Chapter</li></ol></nav></body></html>`,
+		"OEBPS/cover.jpg":   "not really a jpeg. Honest.",
+	})
+	out := &bytes.Buffer{}
+	if err := ToKepub(path, nil, out); err != nil {
+		t.Fatal(err)
+	}
+	kepub := filepath.Join(dir, "book.kepub.epub")
+	if err := os.WriteFile(kepub, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, want string
+	}{
+		{"mimetype", "application/epub+zip"},
+		{"OEBPS/ch1.xhtml", `<p><span class="koboSpan" id="kobo.1.1">Call me Ishmael.</span> <span class="koboSpan" id="kobo.1.2">Some years ago.</span></p>`},
+		{"OEBPS/nav.xhtml", `<li><span class="koboSpan" id="kobo.1.1">Chapter</span></li>`},
+		{"OEBPS/cover.jpg", "not really a jpeg. Honest."},
+		{"OEBPS/content.opf", testOPF},
+	}
+	for _, tt := range tests {
+		if got := readZipFile(t, kepub, tt.name); !strings.Contains(got, tt.want) {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+	book, err := openEpub(kepub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer book.file.Close()
+	if problems := book.Validate(); len(problems) != 0 {
+		t.Errorf("kepub problems: %v", problems)
+	}
+}
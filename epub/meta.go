@@ -0,0 +1,190 @@
+package epub
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Pursuit92/gopds"
+)
+
+// refine copies the EPUB 2 opf: attributes and the EPUB 3 <meta refines>
+// refinements onto the elements they describe.
+func (m *Metadata) refine() {
+	byId := make(map[string]*Element)
+	for _, list := range m.lists() {
+		for i := range *list {
+			el := &(*list)[i]
+			el.Value = strings.TrimSpace(el.Value)
+			for _, a := range el.Attrs {
+				switch a.Name.Local {
+				case "role":
+					el.Role = a.Value
+				case "file-as":
+					el.FileAs = a.Value
+				case "scheme":
+					el.Scheme = a.Value
+				case "event":
+					el.Event = a.Value
+				}
+			}
+			if el.Id != "" {
+				byId[el.Id] = el
+			}
+		}
+	}
+	for _, v := range m.Metas {
+		el, ok := byId[strings.TrimPrefix(v.Refines, "#")]
+		if v.Refines == "" || !ok {
+			continue
+		}
+		val := strings.TrimSpace(v.Value)
+		switch v.Property {
+		case "role":
+			el.Role = val
+		case "file-as":
+			el.FileAs = val
+		case "identifier-type":
+			el.Scheme = val
+		case "title-type":
+			el.Type = val
+		}
+	}
+}
+
+func (m *Metadata) lists() []*[]Element {
+	return []*[]Element{&m.Titles, &m.Creators, &m.Contributors,
+		&m.Publishers, &m.Formats, &m.Dates, &m.Subjects, &m.Descriptions,
+		&m.Rights, &m.Identifiers, &m.Languages}
+}
+
+func first(els []Element) string {
+	for _, v := range els {
+		if v.Value != "" {
+			return v.Value
+		}
+	}
+	return ""
+}
+
+func values(els []Element) []string {
+	out := []string{}
+	for _, v := range els {
+		if v.Value != "" {
+			out = append(out, v.Value)
+		}
+	}
+	return out
+}
+
+// Title returns the main title, which in EPUB 3 needn't be the first.
+func (m *Metadata) Title() string {
+	for _, v := range m.Titles {
+		if v.Type == "main" {
+			return v.Value
+		}
+	}
+	return first(m.Titles)
+}
+
+// Date prefers the publication date over creation or modification dates.
+func (m *Metadata) Date() string {
+	for _, v := range m.Dates {
+		if v.Event == "" || v.Event == "publication" {
+			return v.Value
+		}
+	}
+	return first(m.Dates)
+}
+
+// Series reads EPUB 3 series collections, falling back to the calibre
+// metadata most EPUB 2 books carry.
+func (m *Metadata) Series() (string, float64) {
+	for _, v := range m.Metas {
+		if v.Property != "belongs-to-collection" || v.Id == "" {
+			continue
+		}
+		kind, pos := "", ""
+		for _, r := range m.Metas {
+			if r.Refines != "#"+v.Id {
+				continue
+			}
+			switch r.Property {
+			case "collection-type":
+				kind = strings.TrimSpace(r.Value)
+			case "group-position":
+				pos = strings.TrimSpace(r.Value)
+			}
+		}
+		if kind == "series" {
+			index, _ := strconv.ParseFloat(pos, 64)
+			return strings.TrimSpace(v.Value), index
+		}
+	}
+	name, index := "", 0.0
+	for _, v := range m.Metas {
+		switch v.Name {
+		case "calibre:series":
+			name = v.Content
+		case "calibre:series_index":
+			index, _ = strconv.ParseFloat(v.Content, 64)
+		}
+	}
+	return name, index
+}
+
+// identifierScheme names the scheme of an identifier, inferring it from
+// URN-style values when no scheme was given.
+func identifierScheme(el Element) string {
+	if el.Scheme != "" {
+		return el.Scheme
+	}
+	lower := strings.ToLower(el.Value)
+	for _, v := range []string{"isbn", "uuid", "doi", "issn"} {
+		if strings.HasPrefix(lower, "urn:"+v+":") || strings.HasPrefix(lower, v+":") {
+			return strings.ToUpper(v)
+		}
+	}
+	return ""
+}
+
+func person(el Element) *gopds.OpdsAuthor {
+	return &gopds.OpdsAuthor{Name: el.Value, FileAs: el.FileAs, Role: el.Role}
+}
+
+func (m *Metadata) fill(meta *gopds.OpdsMeta) {
+	meta.Title = m.Title()
+	meta.Publisher = first(m.Publishers)
+	meta.Issued = m.Date()
+	meta.Summary = first(m.Descriptions)
+	meta.Rights = first(m.Rights)
+	meta.Languages = values(m.Languages)
+	if len(meta.Languages) > 0 {
+		meta.Lang = meta.Languages[0]
+	}
+	meta.Subjects = values(m.Subjects)
+	meta.Category = strings.Join(meta.Subjects, ", ")
+	meta.Series, meta.SeriesIndex = m.Series()
+
+	// Creators are authors unless a role says otherwise.
+	for _, v := range m.Creators {
+		if v.Value == "" {
+			continue
+		}
+		if v.Role == "" || v.Role == "aut" {
+			meta.Authors = append(meta.Authors, person(v))
+		} else {
+			meta.Contributors = append(meta.Contributors, person(v))
+		}
+	}
+	for _, v := range m.Contributors {
+		if v.Value != "" {
+			meta.Contributors = append(meta.Contributors, person(v))
+		}
+	}
+	for _, v := range m.Identifiers {
+		if v.Value != "" {
+			meta.Identifiers = append(meta.Identifiers,
+				&gopds.OpdsIdentifier{Scheme: identifierScheme(v), Value: v.Value})
+		}
+	}
+}
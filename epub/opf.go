@@ -2,34 +2,91 @@ package epub
 
 import "encoding/xml"
 
+type Container struct {
+	XMLName   xml.Name   `xml:"container"`
+	Rootfiles []Rootfile `xml:"rootfiles>rootfile"`
+}
+
+type Rootfile struct {
+	FullPath  string `xml:"full-path,attr"`
+	MediaType string `xml:"media-type,attr"`
+}
+
 type Package struct {
 	XMLName  xml.Name    `xml:"package"`
+	Version  string      `xml:"version,attr,omitempty"`
+	UniqueId string      `xml:"unique-identifier,attr,omitempty"`
 	Meta     Metadata    `xml:"metadata,omitempty"`
 	Manifest []Item      `xml:"manifest>item"`
+	Spine    Spine       `xml:"spine"`
 	Guide    []Reference `xml:"guide>reference"`
 }
 
 type Item struct {
-	Id        string `xml:"id,attr,omitempty"`
-	Href      string `xml:"href,attr,omitempty"`
-	MediaType string `xml:"media-type,attr,omitempty"`
+	Id         string `xml:"id,attr,omitempty"`
+	Href       string `xml:"href,attr,omitempty"`
+	MediaType  string `xml:"media-type,attr,omitempty"`
+	Properties string `xml:"properties,attr,omitempty"`
+	Fallback   string `xml:"fallback,attr,omitempty"`
 }
 
+// Metadata keeps every Dublin Core element, since titles, creators,
+// subjects, identifiers and languages may all repeat.
 type Metadata struct {
-	Title       string `xml:"title"`
-	Creator     string `xml:"creator"`
-	Publisher   string `xml:"publisher"`
-	Format      string `xml:"format"`
-	Date        string `xml:"date"`
-	Subject     string `xml:"subject"`
-	Description string `xml:"description"`
-	Rights      string `xml:"rights"`
-	Identifier  string `xml:"identifier"`
-	Language    string `xml:"language"`
+	Titles       []Element `xml:"title"`
+	Creators     []Element `xml:"creator"`
+	Contributors []Element `xml:"contributor"`
+	Publishers   []Element `xml:"publisher"`
+	Formats      []Element `xml:"format"`
+	Dates        []Element `xml:"date"`
+	Subjects     []Element `xml:"subject"`
+	Descriptions []Element `xml:"description"`
+	Rights       []Element `xml:"rights"`
+	Identifiers  []Element `xml:"identifier"`
+	Languages    []Element `xml:"language"`
+	Metas        []Meta    `xml:"meta"`
+}
+
+// Element is a single Dublin Core element. The EPUB 2 opf: attributes and
+// EPUB 3 refinements are folded into Role, FileAs, Scheme and friends by
+// Metadata.refine.
+type Element struct {
+	Id     string     `xml:"id,attr,omitempty"`
+	Attrs  []xml.Attr `xml:",any,attr"`
+	Value  string     `xml:",chardata"`
+	Role   string     `xml:"-"`
+	FileAs string     `xml:"-"`
+	Scheme string     `xml:"-"`
+	Event  string     `xml:"-"`
+	// EPUB 3 title-type: main, subtitle, collection, ...
+	Type string `xml:"-"`
+}
+
+// Meta covers both the EPUB 2 name/content form and the EPUB 3
+// property form of <meta>.
+type Meta struct {
+	Name     string `xml:"name,attr,omitempty"`
+	Content  string `xml:"content,attr,omitempty"`
+	Property string `xml:"property,attr,omitempty"`
+	Refines  string `xml:"refines,attr,omitempty"`
+	Id       string `xml:"id,attr,omitempty"`
+	Scheme   string `xml:"scheme,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+// Spine is the reading order. Toc names the NCX item in EPUB 2.
+type Spine struct {
+	Toc      string    `xml:"toc,attr,omitempty"`
+	Itemrefs []Itemref `xml:"itemref"`
+}
+
+type Itemref struct {
+	Idref  string `xml:"idref,attr"`
+	Linear string `xml:"linear,attr,omitempty"`
 }
 
 type Reference struct {
-	Href  string `xm:"href,attr"`
-	Title string `xm:"title,attr"`
-	Type  string `xm:"type,attr"`
+	Href  string `xml:"href,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
 }
@@ -0,0 +1,71 @@
+package epub
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Pursuit92/gopds"
+)
+
+// resources serves the files of a stored epub by their path in the
+// archive, so documents may link to anything the book contains.
+type resources struct {
+	book *Epub
+	r    *Rendition
+}
+
+func OpenResources(path string) (gopds.Resources, error) {
+	book, err := openEpub(filepath.FromSlash(path))
+	if err != nil {
+		return nil, err
+	}
+	return &resources{book, book.Renditions[0]}, nil
+}
+
+// Spine skips non-linear items, which reading systems show only when
+// linked to, and remote resources.
+func (res *resources) Spine() []string {
+	spine := []string{}
+	for _, v := range res.r.Spine.Itemrefs {
+		item := res.r.itemById(v.Idref)
+		if item == nil || v.Linear == "no" || isRemote(item.Href) {
+			continue
+		}
+		spine = append(spine, res.r.Resolve(item.Href))
+	}
+	return spine
+}
+
+func (res *resources) Open(name string) (io.ReadCloser, string, error) {
+	full := path.Clean(name)
+	if full == ".." || strings.HasPrefix(full, "../") || strings.HasPrefix(full, "/") {
+		return nil, "", errors.New("Invalid resource path: " + name)
+	}
+	f := res.book.zipFile(full)
+	if f == nil {
+		return nil, "", formatError(res.book.path, "missing "+full, nil)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	mediaType := ""
+	if item := res.r.itemByPath(full); item != nil {
+		mediaType = item.MediaType
+	}
+	if mediaType == "" {
+		mediaType = mime.TypeByExtension(path.Ext(name))
+	}
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	return rc, mediaType, nil
+}
+
+func (res *resources) Close() {
+	res.book.file.Close()
+}
@@ -0,0 +1,62 @@
+package epub
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.epub")
+	opf := strings.Replace(testOPF, `href="cover.jpg"`, `href="../images/cover.jpg"`, 1)
+	writeTestEpub(t, path, map[string]string{
+		"OEBPS/content.opf":  opf,
+		"OEBPS/ch1.xhtml":    `<html><body><img src="../images/cover.jpg"/></body></html>`,
+		"OEBPS/nav.xhtml":    `<html/>`,
+		"images/cover.jpg":   "jpeg",
+		"OEBPS/style.css":    "p {}",
+		"OEBPS/unlisted.bin": "data",
+	})
+	res, err := OpenResources(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	if spine := res.Spine(); !reflect.DeepEqual(spine, []string{"OEBPS/ch1.xhtml"}) {
+		t.Errorf("spine %v", spine)
+	}
+	tests := []struct {
+		name, mediaType, data string
+	}{
+		{"OEBPS/ch1.xhtml", "application/xhtml+xml", "<html>"},
+		{"images/cover.jpg", "image/jpeg", "jpeg"},
+		{"OEBPS/../images/cover.jpg", "image/jpeg", "jpeg"},
+		{"./OEBPS/style.css", "text/css; charset=utf-8", "p {}"},
+		{"OEBPS/unlisted.bin", "application/octet-stream", "data"},
+		{"../images/cover.jpg", "", ""},
+		{"OEBPS/../../images/cover.jpg", "", ""},
+		{"/images/cover.jpg", "", ""},
+		{"OEBPS/missing.xhtml", "", ""},
+	}
+	for _, tt := range tests {
+		rc, mediaType, err := res.Open(tt.name)
+		if tt.data == "" {
+			if err == nil {
+				rc.Close()
+				t.Errorf("opened %s", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		data, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		if mediaType != tt.mediaType || !strings.HasPrefix(string(data), tt.data) {
+			t.Errorf("%s: %s %q, want %s %q", tt.name, mediaType, data, tt.mediaType, tt.data)
+		}
+	}
+}
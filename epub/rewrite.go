@@ -0,0 +1,486 @@
+package epub
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pursuit92/gopds"
+)
+
+const (
+	dcNs  = "http://purl.org/dc/elements/1.1/"
+	opfNs = "http://www.idpf.org/2007/opf"
+	// Manifest id of a cover image added by WriteMeta.
+	coverId = "gopds-cover"
+)
+
+// Dublin Core elements regenerated from the catalog metadata. The rest,
+// identifiers included, are carried over untouched.
+var rewrittenDC = map[string]bool{
+	"title":       true,
+	"creator":     true,
+	"contributor": true,
+	"publisher":   true,
+	"date":        true,
+	"description": true,
+	"rights":      true,
+	"subject":     true,
+	"language":    true,
+}
+
+// WriteMeta copies the epub at path to out with the metadata of its
+// default package document replaced by meta. A non-nil cover replaces the
+// cover image. It is a gopds.MetaWriter.
+func WriteMeta(path string, out io.Writer, meta *gopds.OpdsMeta, cover []byte) error {
+	book, err := openEpub(filepath.FromSlash(path))
+	if err != nil {
+		return err
+	}
+	defer book.file.Close()
+	r := book.Renditions[0]
+	raw, err := book.readFile(r.Path)
+	if err != nil {
+		return err
+	}
+
+	var newCover *Item
+	coverPath := ""
+	if cover != nil {
+		if book.HasCover && book.CoverType == meta.CoverType {
+			coverPath = book.coverPath
+		} else {
+			newCover = &Item{Id: coverId,
+				Href:      coverId + coverExt(meta.CoverType),
+				MediaType: meta.CoverType}
+			coverPath = r.Resolve(newCover.Href)
+		}
+	}
+	opf, err := rewriteOPF(raw, r.Package, meta, newCover)
+	if err != nil {
+		return formatError(book.path, "malformed "+r.Path, err)
+	}
+
+	w, err := NewWriter(out)
+	if err != nil {
+		return err
+	}
+	coverWritten := false
+	for _, f := range book.file.File {
+		switch f.Name {
+		case "mimetype":
+			continue
+		case r.Path:
+			err = w.WriteFile(f.Name, opf)
+		case coverPath:
+			err = w.WriteFile(f.Name, cover)
+			coverWritten = true
+		default:
+			err = w.Copy(f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if cover != nil && !coverWritten {
+		err = w.WriteFile(coverPath, cover)
+		if err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+func (book *Epub) readFile(name string) ([]byte, error) {
+	f := book.zipFile(name)
+	if f == nil {
+		return nil, formatError(book.path, "missing "+name, nil)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, formatError(book.path, "unreadable "+name, err)
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+func coverExt(mediaType string) string {
+	switch mediaType {
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/svg+xml":
+		return ".svg"
+	}
+	return ".jpg"
+}
+
+// edit replaces raw[start:end] with text.
+type edit struct {
+	start, end int64
+	text       string
+}
+
+// child is an element directly inside <metadata> or <manifest>.
+type child struct {
+	section    string
+	el         xml.StartElement
+	start, end int64
+}
+
+// rewriteOPF replaces the descriptive metadata of a package document,
+// leaving everything else byte for byte as it was. Raw tokens are used so
+// the prefixes the document chose are preserved.
+func rewriteOPF(raw []byte, pkg *Package, meta *gopds.OpdsMeta, newCover *Item) ([]byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(raw))
+	prefixes := make(map[string]string)
+	ids := make(map[string]bool)
+	children := []*child{}
+	var metaEnd, manifestEnd int64 = -1, -1
+	// An empty manifest may be written <manifest/>, leaving no closing tag
+	// to insert before.
+	var manifestStart, tagEnd int64
+	manifestName := ""
+	depth := 0
+	section := ""
+	for {
+		off := dec.InputOffset()
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" {
+					prefixes[a.Value] = a.Name.Local
+				}
+				if a.Name.Space == "" && a.Name.Local == "id" {
+					ids[a.Value] = true
+				}
+			}
+			if depth == 2 {
+				section = t.Name.Local
+				if section == "manifest" {
+					manifestStart, tagEnd = off, dec.InputOffset()
+					manifestName = rawName(t.Name)
+				}
+			}
+			if depth == 3 && (section == "metadata" || section == "manifest") {
+				children = append(children, &child{section: section, el: t.Copy(), start: off})
+			}
+		case xml.EndElement:
+			if depth == 3 && len(children) > 0 && (section == "metadata" || section == "manifest") {
+				children[len(children)-1].end = dec.InputOffset()
+			}
+			if depth == 2 {
+				switch section {
+				case "metadata":
+					metaEnd = off
+				case "manifest":
+					manifestEnd = off
+					if off == tagEnd {
+						manifestEnd = -2
+					}
+				}
+			}
+			depth--
+		}
+	}
+	if metaEnd < 0 || manifestEnd == -1 {
+		return nil, fmt.Errorf("no metadata or manifest")
+	}
+
+	m := &opfMeta{buf: &bytes.Buffer{},
+		dc:  prefixes[dcNs],
+		opf: prefixes[opfNs],
+		v3:  strings.HasPrefix(pkg.Version, "3"),
+		ids: ids}
+	if m.dc == "" {
+		m.dc, m.decl = "dc", ` xmlns:dc="`+dcNs+`"`
+	}
+	if m.opf == "" && !m.v3 {
+		m.opf, m.decl = "opf", m.decl+` xmlns:opf="`+opfNs+`"`
+	}
+
+	// Drop the elements being regenerated, along with any refinements of
+	// them.
+	dropped := make(map[string]bool)
+	drop := make(map[*child]bool)
+	for _, c := range children {
+		if c.section != "metadata" {
+			continue
+		}
+		name, property := attrValue(c.el, "name"), attrValue(c.el, "property")
+		switch {
+		case c.el.Name.Space == m.dc && rewrittenDC[c.el.Name.Local],
+			c.el.Name.Local == "meta" && property == "belongs-to-collection":
+			drop[c] = true
+			if id := attrValue(c.el, "id"); id != "" {
+				dropped[id] = true
+			}
+		case c.el.Name.Local == "meta" && (property == "dcterms:modified" ||
+			name == "calibre:series" || name == "calibre:series_index" ||
+			(name == "cover" && newCover != nil)):
+			drop[c] = true
+		}
+		if m.indent == "" {
+			m.indent = lineIndent(raw, c.start)
+		}
+	}
+	if m.indent == "" {
+		m.indent = "    "
+	}
+	// the ids of dropped elements are free for the regenerated ones
+	for id := range dropped {
+		delete(ids, id)
+	}
+
+	edits := []edit{}
+	for _, c := range children {
+		refines := strings.TrimPrefix(attrValue(c.el, "refines"), "#")
+		switch {
+		case drop[c], c.section == "metadata" && c.el.Name.Local == "meta" && dropped[refines]:
+			edits = append(edits, edit{lineStart(raw, c.start), c.end, ""})
+		case c.section == "manifest" && newCover != nil && attrValue(c.el, "id") == coverId:
+			edits = append(edits, edit{lineStart(raw, c.start), c.end, ""})
+		case c.section == "manifest" && newCover != nil && hasProperty(attrValue(c.el, "properties"), "cover-image"):
+			edits = append(edits, edit{c.start, c.end, withoutCoverProperty(c.el)})
+		}
+	}
+
+	m.write(meta)
+	if newCover != nil {
+		m.line(`<meta name="cover" content="` + coverId + `"/>`)
+	}
+	edits = append(edits, insertLines(raw, metaEnd, m.buf.String()))
+	if newCover != nil {
+		properties := ""
+		if m.v3 {
+			properties = ` properties="cover-image"`
+		}
+		item := fmt.Sprintf(`%s<item id="%s" href="%s" media-type="%s"%s/>`+"\n",
+			m.indent, coverId, escape(newCover.Href), escape(newCover.MediaType), properties)
+		if manifestEnd < 0 {
+			open := strings.TrimSpace(strings.TrimSuffix(string(raw[manifestStart:tagEnd]), "/>"))
+			edits = append(edits, edit{manifestStart, tagEnd, open + ">\n" + item + "</" + manifestName + ">"})
+		} else {
+			edits = append(edits, insertLines(raw, manifestEnd, item))
+		}
+	}
+
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	out := &bytes.Buffer{}
+	pos := int64(0)
+	for _, v := range edits {
+		out.Write(raw[pos:v.start])
+		out.WriteString(v.text)
+		pos = v.end
+	}
+	out.Write(raw[pos:])
+	return out.Bytes(), nil
+}
+
+// lineStart moves a drop back over the indentation and line break before
+// an element so removing it doesn't leave an empty line.
+func lineStart(raw []byte, start int64) int64 {
+	for start > 0 && (raw[start-1] == ' ' || raw[start-1] == '\t') {
+		start--
+	}
+	if start > 0 && raw[start-1] == '\n' {
+		start--
+	}
+	if start > 0 && raw[start-1] == '\r' {
+		start--
+	}
+	return start
+}
+
+// insertLines inserts whole lines before the closing tag at off.
+func insertLines(raw []byte, off int64, lines string) edit {
+	i := off
+	for i > 0 && (raw[i-1] == ' ' || raw[i-1] == '\t') {
+		i--
+	}
+	if i > 0 && raw[i-1] == '\n' {
+		return edit{i, i, lines}
+	}
+	return edit{off, off, "\n" + lines}
+}
+
+func lineIndent(raw []byte, start int64) string {
+	i := start
+	for i > 0 && (raw[i-1] == ' ' || raw[i-1] == '\t') {
+		i--
+	}
+	if i > 0 && raw[i-1] != '\n' {
+		return ""
+	}
+	return string(raw[i:start])
+}
+
+func hasProperty(properties, property string) bool {
+	for _, v := range strings.Fields(properties) {
+		if v == property {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutCoverProperty re-serializes a manifest item minus its
+// cover-image property.
+func withoutCoverProperty(el xml.StartElement) string {
+	out := "<" + rawName(el.Name)
+	for _, a := range el.Attr {
+		value := a.Value
+		if a.Name.Space == "" && a.Name.Local == "properties" {
+			fields := []string{}
+			for _, v := range strings.Fields(value) {
+				if v != "cover-image" {
+					fields = append(fields, v)
+				}
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			value = strings.Join(fields, " ")
+		}
+		out += " " + rawName(a.Name) + `="` + escape(value) + `"`
+	}
+	return out + "/>"
+}
+
+func rawName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// opfMeta writes package metadata in either EPUB 2 or EPUB 3 form, using
+// the namespace prefixes of the document it goes into.
+type opfMeta struct {
+	buf     *bytes.Buffer
+	indent  string
+	dc, opf string
+	// namespace declarations for prefixes the document lacks
+	decl string
+	v3   bool
+	// ids already used in the document
+	ids map[string]bool
+}
+
+func (m *opfMeta) line(s string) {
+	m.buf.WriteString(m.indent + s + "\n")
+}
+
+// newId returns base, or base with a numeric suffix when the document
+// already uses that id, and reserves it.
+func (m *opfMeta) newId(base string) string {
+	if m.ids == nil {
+		m.ids = make(map[string]bool)
+	}
+	id := base
+	for n := 2; m.ids[id]; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	m.ids[id] = true
+	return id
+}
+
+// element writes a Dublin Core element. attrs, if any, start with a space.
+func (m *opfMeta) element(tag, attrs, value string) {
+	if value == "" {
+		return
+	}
+	m.line(fmt.Sprintf("<%s:%s%s%s>%s</%s:%s>", m.dc, tag, m.decl, attrs, escape(value), m.dc, tag))
+}
+
+// people writes dc:creator or dc:contributor elements. EPUB 3 expresses
+// roles and file-as names as refinements, EPUB 2 as opf: attributes.
+func (m *opfMeta) people(tag string, people []*gopds.OpdsAuthor) {
+	for i, v := range people {
+		role := v.Role
+		if role == "" && tag == "creator" {
+			role = "aut"
+		}
+		if !m.v3 {
+			attrs := ""
+			if role != "" {
+				attrs += fmt.Sprintf(` %s:role="%s"`, m.opf, escape(role))
+			}
+			if v.FileAs != "" {
+				attrs += fmt.Sprintf(` %s:file-as="%s"`, m.opf, escape(v.FileAs))
+			}
+			m.element(tag, attrs, v.Name)
+			continue
+		}
+		if v.Name == "" {
+			continue
+		}
+		id := m.newId(fmt.Sprintf("%s%d", tag, i+1))
+		m.element(tag, ` id="`+id+`"`, v.Name)
+		if role != "" {
+			m.line(fmt.Sprintf(`<meta refines="#%s" property="role" scheme="marc:relators">%s</meta>`, id, escape(role)))
+		}
+		if v.FileAs != "" {
+			m.line(fmt.Sprintf(`<meta refines="#%s" property="file-as">%s</meta>`, id, escape(v.FileAs)))
+		}
+	}
+}
+
+// write writes every element that rewriteOPF regenerates.
+func (m *opfMeta) write(meta *gopds.OpdsMeta) {
+	m.element("title", "", meta.Title)
+	m.people("creator", meta.Authors)
+	m.people("contributor", meta.Contributors)
+	languages := meta.Languages
+	if len(languages) == 0 && meta.Lang != "" {
+		languages = []string{meta.Lang}
+	}
+	for _, v := range languages {
+		m.element("language", "", v)
+	}
+	subjects := meta.Subjects
+	if len(subjects) == 0 && meta.Category != "" {
+		subjects = strings.Split(meta.Category, ", ")
+	}
+	for _, v := range subjects {
+		m.element("subject", "", v)
+	}
+	m.element("publisher", "", meta.Publisher)
+	m.element("date", "", meta.Issued)
+	m.element("description", "", meta.Summary)
+	m.element("rights", "", meta.Rights)
+
+	index := strconv.FormatFloat(meta.SeriesIndex, 'f', -1, 64)
+	if m.v3 {
+		if meta.Series != "" {
+			id := m.newId("series")
+			m.line(`<meta property="belongs-to-collection" id="` + id + `">` + escape(meta.Series) + `</meta>`)
+			m.line(`<meta refines="#` + id + `" property="collection-type">series</meta>`)
+			if meta.SeriesIndex != 0 {
+				m.line(`<meta refines="#` + id + `" property="group-position">` + index + `</meta>`)
+			}
+		}
+		m.line(`<meta property="dcterms:modified">` + time.Now().UTC().Format("2006-01-02T15:04:05Z") + `</meta>`)
+	} else if meta.Series != "" {
+		m.line(`<meta name="calibre:series" content="` + escape(meta.Series) + `"/>`)
+		if meta.SeriesIndex != 0 {
+			m.line(`<meta name="calibre:series_index" content="` + index + `"/>`)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Pursuit92/gopds"
+)
+
+const testOPF = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="uid">urn:uuid:0c5d2a3e-6d5b-4e4f-9a43-3c1a1c7e2a10</dc:identifier>
+    <dc:title>Old Title</dc:title>
+    <dc:language>en</dc:language>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="cover" href="cover.jpg" media-type="image/jpeg" properties="cover-image"/>
+  </manifest>
+  <spine>
+    <itemref idref="ch1"/>
+    <itemref idref="nav" linear="no"/>
+  </spine>
+  <guide>
+    <reference type="text" href="ch1.xhtml"/>
+  </guide>
+</package>
+`
+
+// writeTestEpub stores an epub made of files, with the OCF container
+// pointing at OEBPS/content.opf.
+func writeTestEpub(t *testing.T, path string, files map[string]string) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.WriteFile(containerPath, []byte(containerXML)); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err = w.WriteFile(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readZipFile(t *testing.T, path, name string) string {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			data := &bytes.Buffer{}
+			data.ReadFrom(rc)
+			return data.String()
+		}
+	}
+	t.Fatalf("%s has no %s", path, name)
+	return ""
+}
+
+func TestWriteMetaCovers(t *testing.T) {
+	tests := []struct {
+		name string
+		// cover types written one after another
+		covers []string
+		// zip path of the final cover
+		path string
+	}{
+		{"same type", []string{"image/jpeg"}, "OEBPS/cover.jpg"},
+		{"new type, cover item last", []string{"image/png"}, "OEBPS/gopds-cover.png"},
+		{"two new types", []string{"image/png", "image/gif"}, "OEBPS/gopds-cover.gif"},
+		{"new type, then back", []string{"image/png", "image/jpeg", "image/png"}, "OEBPS/gopds-cover.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "0.epub")
+			writeTestEpub(t, path, map[string]string{
+				"OEBPS/content.opf": testOPF,
+				"OEBPS/nav.xhtml":   "<html/>",
+				"OEBPS/ch1.xhtml":   "<html/>",
+				"OEBPS/cover.jpg":   "jpeg"})
+			for i, coverType := range tt.covers {
+				out := &bytes.Buffer{}
+				meta := &gopds.OpdsMeta{Title: "New Title",
+					Authors:   []*gopds.OpdsAuthor{{Name: "A. Writer"}},
+					CoverType: coverType}
+				err := WriteMeta(path, out, meta, []byte(coverType))
+				if err != nil {
+					t.Fatalf("cover %d: %s", i, err)
+				}
+				path = filepath.Join(dir, strings.Repeat("x", i+1)+".epub")
+				if err = os.WriteFile(path, out.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			book, err := openEpub(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer book.file.Close()
+			last := tt.covers[len(tt.covers)-1]
+			if !book.HasCover || book.coverPath != tt.path || book.CoverType != last {
+				t.Errorf("cover %s (%s), want %s (%s)", book.coverPath, book.CoverType, tt.path, last)
+			}
+			if data := readZipFile(t, path, book.coverPath); data != last {
+				t.Errorf("cover holds %q, want %q", data, last)
+			}
+			if title := book.OpdsMeta().Title; title != "New Title" {
+				t.Errorf("title %q, want New Title", title)
+			}
+			r := book.Renditions[0]
+			if len(r.Spine.Itemrefs) != 2 || len(r.Guide) != 1 {
+				t.Errorf("spine or guide lost:\n%s", readZipFile(t, path, "OEBPS/content.opf"))
+			}
+			covers := 0
+			for _, v := range r.Manifest {
+				if hasProperty(v.Properties, "cover-image") {
+					covers++
+				}
+			}
+			if covers != 1 {
+				t.Errorf("%d cover-image items, want 1", covers)
+			}
+		})
+	}
+}
+
+func TestRewriteIds(t *testing.T) {
+	opf := `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="uid">urn:uuid:1</dc:identifier>
+    <dc:title>Old Title</dc:title>
+    <dc:creator id="creator2">Old Author</dc:creator>
+    <meta refines="#creator2" property="role" scheme="marc:relators">aut</meta>
+  </metadata>
+  <manifest>
+    <item id="creator1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="series" href="ch2.xhtml" media-type="application/xhtml+xml"/>
+    <item id="series-2" href="ch3.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine>
+    <itemref idref="creator1"/>
+    <itemref idref="series"/>
+    <itemref idref="series-2"/>
+  </spine>
+</package>
+`
+	meta := &gopds.OpdsMeta{Title: "New Title",
+		Authors: []*gopds.OpdsAuthor{{Name: "First"}, {Name: "Second"}},
+		Series:  "Saga", SeriesIndex: 2}
+	out, err := rewriteOPF([]byte(opf), &Package{Version: "3.0"}, meta, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(out)
+	for _, want := range []string{
+		`<dc:creator id="creator1-2">First</dc:creator>`,
+		`<meta refines="#creator1-2" property="role" scheme="marc:relators">aut</meta>`,
+		// the id of the replaced creator is free again
+		`<dc:creator id="creator2">Second</dc:creator>`,
+		`<meta property="belongs-to-collection" id="series-3">Saga</meta>`,
+		`<meta refines="#series-3" property="group-position">2</meta>`,
+		`<item id="series" href="ch2.xhtml"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in:\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, `id="creator2"`); n != 1 {
+		t.Errorf("creator2 used %d times:\n%s", n, got)
+	}
+}
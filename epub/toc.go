@@ -0,0 +1,179 @@
+package epub
+
+import (
+	"encoding/xml"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Pursuit92/gopds"
+)
+
+type ncx struct {
+	NavMap []navPoint `xml:"navMap>navPoint"`
+}
+
+type navPoint struct {
+	Label    string     `xml:"navLabel>text"`
+	Src      navContent `xml:"content"`
+	Children []navPoint `xml:"navPoint"`
+}
+
+type navContent struct {
+	Src string `xml:"src,attr"`
+}
+
+// Toc reads the table of contents from the EPUB 3 navigation document,
+// falling back to the EPUB 2 NCX. Hrefs are resolved to archive paths.
+func (book *Epub) Toc() []*gopds.OpdsTocEntry {
+	r := book.Renditions[0]
+	if item := r.propertyItem("nav"); item != nil {
+		toc := book.navToc(r.Resolve(item.Href))
+		if len(toc) > 0 {
+			return toc
+		}
+	}
+	item := r.itemById(r.Spine.Toc)
+	if item == nil {
+		for i, v := range r.Manifest {
+			if v.MediaType == "application/x-dtbncx+xml" {
+				item = &r.Manifest[i]
+				break
+			}
+		}
+	}
+	if item == nil {
+		return nil
+	}
+	name := r.Resolve(item.Href)
+	doc := &ncx{}
+	if book.decodeFile(name, doc) != nil {
+		return nil
+	}
+	return ncxToc(path.Dir(name), doc.NavMap)
+}
+
+func ncxToc(dir string, points []navPoint) []*gopds.OpdsTocEntry {
+	toc := []*gopds.OpdsTocEntry{}
+	for _, v := range points {
+		toc = append(toc, &gopds.OpdsTocEntry{Title: collapse(v.Label),
+			Href:     resolveHref(dir, v.Src.Src),
+			Children: ncxToc(dir, v.Children)})
+	}
+	return toc
+}
+
+// navToc walks the nested lists of the nav element of type toc.
+func (book *Epub) navToc(name string) []*gopds.OpdsTocEntry {
+	f := book.zipFile(name)
+	if f == nil {
+		return nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil
+	}
+	defer rc.Close()
+	dec := xml.NewDecoder(rc)
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+
+	toc := []*gopds.OpdsTocEntry{}
+	lists := []*[]*gopds.OpdsTocEntry{}
+	items := []*gopds.OpdsTocEntry{}
+	inNav, label := 0, 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if inNav == 0 {
+				if t.Name.Local == "nav" && hasProperty(attrValue(t, "type"), "toc") {
+					inNav = 1
+				}
+				continue
+			}
+			inNav++
+			switch t.Name.Local {
+			case "ol":
+				if len(items) > 0 {
+					lists = append(lists, &items[len(items)-1].Children)
+				} else {
+					lists = append(lists, &toc)
+				}
+			case "li":
+				if len(lists) == 0 {
+					continue
+				}
+				entry := &gopds.OpdsTocEntry{}
+				list := lists[len(lists)-1]
+				*list = append(*list, entry)
+				items = append(items, entry)
+			case "a", "span":
+				label++
+				if t.Name.Local == "a" && len(items) > 0 {
+					items[len(items)-1].Href = resolveHref(path.Dir(name), attrValue(t, "href"))
+				}
+			}
+		case xml.EndElement:
+			if inNav == 0 {
+				continue
+			}
+			inNav--
+			if inNav == 0 {
+				return trimToc(toc)
+			}
+			switch t.Name.Local {
+			case "ol":
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+			case "li":
+				if len(items) > 0 {
+					items = items[:len(items)-1]
+				}
+			case "a", "span":
+				if label > 0 {
+					label--
+				}
+			}
+		case xml.CharData:
+			if label > 0 && len(items) > 0 {
+				items[len(items)-1].Title += string(t)
+			}
+		}
+	}
+	return trimToc(toc)
+}
+
+func trimToc(toc []*gopds.OpdsTocEntry) []*gopds.OpdsTocEntry {
+	for _, v := range toc {
+		v.Title = collapse(v.Title)
+		v.Children = trimToc(v.Children)
+	}
+	return toc
+}
+
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// resolveHref resolves a link relative to dir, keeping the fragment.
+func resolveHref(dir, href string) string {
+	if href == "" {
+		return ""
+	}
+	fragment := ""
+	if i := strings.Index(href, "#"); i >= 0 {
+		href, fragment = href[:i], href[i:]
+	}
+	if href == "" {
+		return fragment
+	}
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	return resolve(dir, href) + fragment
+}
@@ -0,0 +1,180 @@
+package epub
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var rejectInvalid bool = false
+
+func init() {
+	flag.BoolVar(&rejectInvalid, "rejectinvalid", false, "Refuse to import epubs with fatal structural errors")
+}
+
+// Problem is a structural defect found by Validate. Fatal problems keep
+// reading systems from opening the book at all.
+type Problem struct {
+	Fatal   bool
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Fatal {
+		return "error: " + p.Message
+	}
+	return "warning: " + p.Message
+}
+
+func problem(fatal bool, format string, args ...interface{}) Problem {
+	return Problem{fatal, fmt.Sprintf(format, args...)}
+}
+
+// coreMediaTypes are the EPUB 3 core media types, plus the EPUB 2 types
+// older books still use. Reading systems need not support anything else
+// unless the manifest offers a fallback.
+var coreMediaTypes = map[string]bool{
+	"application/xhtml+xml":         true,
+	"application/x-dtbncx+xml":      true,
+	"application/x-dtbook+xml":      true,
+	"application/smil+xml":          true,
+	"application/pls+xml":           true,
+	"application/javascript":        true,
+	"application/ecmascript":        true,
+	"application/font-sfnt":         true,
+	"application/font-woff":         true,
+	"application/vnd.ms-opentype":   true,
+	"application/oebps-package+xml": true,
+	"text/css":                      true,
+	"text/javascript":               true,
+	"text/x-oeb1-document":          true,
+	"text/x-oeb1-css":               true,
+	"image/gif":                     true,
+	"image/jpeg":                    true,
+	"image/png":                     true,
+	"image/svg+xml":                 true,
+	"image/webp":                    true,
+	"audio/mpeg":                    true,
+	"audio/mp4":                     true,
+	"audio/ogg":                     true,
+	"font/otf":                      true,
+	"font/ttf":                      true,
+	"font/woff":                     true,
+	"font/woff2":                    true,
+}
+
+// Validate checks the archive and package documents for the mistakes that
+// most often make a book fail on a device. ReadEpub already refuses books
+// without a container.xml or package document, so it never sees those
+// reported here.
+func (book *Epub) Validate() []Problem {
+	problems := book.checkMimetype()
+	if book.zipFile(containerPath) == nil {
+		problems = append(problems, problem(true, "missing %s", containerPath))
+	}
+	for _, r := range book.Renditions {
+		problems = append(problems, book.checkRendition(r)...)
+	}
+	return problems
+}
+
+func (book *Epub) checkMimetype() []Problem {
+	files := book.file.File
+	f := book.zipFile("mimetype")
+	if f == nil {
+		return []Problem{problem(true, "missing mimetype entry")}
+	}
+	problems := []Problem{}
+	rc, err := f.Open()
+	if err != nil {
+		return []Problem{problem(true, "unreadable mimetype entry: %v", err)}
+	}
+	content := make([]byte, 64)
+	n, _ := rc.Read(content)
+	rc.Close()
+	if strings.TrimSpace(string(content[:n])) != "application/epub+zip" {
+		problems = append(problems, problem(true, "mimetype entry is %q, not application/epub+zip", content[:n]))
+	}
+	if files[0] != f {
+		problems = append(problems, problem(false, "mimetype is not the first entry in the archive"))
+	}
+	if f.Method != zip.Store {
+		problems = append(problems, problem(false, "mimetype entry is compressed"))
+	}
+	return problems
+}
+
+func (book *Epub) checkRendition(r *Rendition) []Problem {
+	problems := []Problem{}
+	ids := make(map[string]bool)
+	for _, v := range r.Manifest {
+		if ids[v.Id] {
+			problems = append(problems, problem(false, "%s: duplicate manifest id %q", r.Path, v.Id))
+		}
+		ids[v.Id] = true
+		if v.MediaType == "" {
+			problems = append(problems, problem(false, "%s: manifest item %q has no media-type", r.Path, v.Id))
+		} else if !isCoreMediaType(v.MediaType) && v.Fallback == "" {
+			problems = append(problems, problem(false, "%s: manifest item %q has non-core media-type %s and no fallback", r.Path, v.Id, v.MediaType))
+		}
+		if isRemote(v.Href) {
+			continue
+		}
+		if book.zipFile(r.Resolve(v.Href)) == nil {
+			problems = append(problems, problem(false, "%s: manifest item %q refers to missing file %s", r.Path, v.Id, r.Resolve(v.Href)))
+		}
+	}
+
+	if len(r.Spine.Itemrefs) == 0 {
+		problems = append(problems, problem(true, "%s: spine is empty", r.Path))
+	}
+	for _, v := range r.Spine.Itemrefs {
+		item := r.itemById(v.Idref)
+		if item == nil {
+			problems = append(problems, problem(true, "%s: spine refers to unknown id %q", r.Path, v.Idref))
+		} else if !isRemote(item.Href) && book.zipFile(r.Resolve(item.Href)) == nil {
+			problems = append(problems, problem(true, "%s: spine item %q is missing from the archive", r.Path, v.Idref))
+		}
+	}
+	if r.Spine.Toc != "" && r.itemById(r.Spine.Toc) == nil {
+		problems = append(problems, problem(false, "%s: spine toc refers to unknown id %q", r.Path, r.Spine.Toc))
+	}
+
+	for _, v := range r.Meta.Metas {
+		if v.Name == "cover" && r.itemById(v.Content) == nil && r.itemByPath(r.Resolve(v.Content)) == nil {
+			problems = append(problems, problem(false, "%s: cover meta refers to unknown item %q", r.Path, v.Content))
+		}
+	}
+	if item := r.propertyItem("cover-image"); item != nil && !isImage(item.MediaType) {
+		problems = append(problems, problem(false, "%s: cover-image item %q is %s, not an image", r.Path, item.Id, item.MediaType))
+	}
+	for _, v := range r.Guide {
+		if strings.EqualFold(v.Type, "cover") && book.zipFile(r.Resolve(v.Href)) == nil {
+			problems = append(problems, problem(false, "%s: guide cover refers to missing file %s", r.Path, r.Resolve(v.Href)))
+		}
+	}
+	return problems
+}
+
+// isCoreMediaType ignores parameters such as the codecs of audio types.
+func isCoreMediaType(mediaType string) bool {
+	mediaType = strings.SplitN(mediaType, ";", 2)[0]
+	return coreMediaTypes[strings.ToLower(strings.TrimSpace(mediaType))]
+}
+
+// isRemote reports whether an href points outside the archive, which EPUB
+// 3 allows for some resources.
+func isRemote(href string) bool {
+	return strings.Contains(href, "://")
+}
+
+func fatal(problems []Problem) []string {
+	out := []string{}
+	for _, v := range problems {
+		if v.Fatal {
+			out = append(out, v.Message)
+		}
+	}
+	return out
+}
@@ -0,0 +1,178 @@
+package epub
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type zipEntry struct {
+	name, data string
+	method     uint16
+}
+
+// writeRawZip stores entries in order, so tests can build archives that
+// break the OCF rules NewWriter follows.
+func writeRawZip(t *testing.T, path string, entries []zipEntry) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, v := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: v.name, Method: v.method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(v.data))
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func validateOPF(manifest, spine string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="uid">urn:uuid:1</dc:identifier>
+    <dc:title>T</dc:title>
+  </metadata>
+  <manifest>
+    <item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+    ` + manifest + `
+  </manifest>
+  <spine>` + spine + `</spine>
+</package>`
+}
+
+func TestValidate(t *testing.T) {
+	mimetype := zipEntry{"mimetype", "application/epub+zip", zip.Store}
+	container := zipEntry{containerPath, containerXML, zip.Deflate}
+	chapter := zipEntry{"OEBPS/ch1.xhtml", "<html/>", zip.Deflate}
+	opf := func(manifest, spine string) zipEntry {
+		return zipEntry{"OEBPS/content.opf", validateOPF(manifest, spine), zip.Deflate}
+	}
+	valid := opf("", `<itemref idref="ch1"/>`)
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		fatal   bool
+		want    string
+	}{
+		{"valid", []zipEntry{mimetype, container, valid, chapter}, false, ""},
+		{"wrong mimetype", []zipEntry{{"mimetype", "application/zip", zip.Store}, container, valid, chapter},
+			true, "not application/epub+zip"},
+		{"mimetype not first", []zipEntry{container, mimetype, valid, chapter}, false, "not the first entry"},
+		{"mimetype compressed", []zipEntry{{"mimetype", "application/epub+zip", zip.Deflate}, container, valid, chapter},
+			false, "mimetype entry is compressed"},
+		{"empty spine", []zipEntry{mimetype, container, opf("", ""), chapter}, true, "spine is empty"},
+		{"unknown spine id", []zipEntry{mimetype, container, opf("", `<itemref idref="ch2"/>`), chapter},
+			true, `unknown id "ch2"`},
+		{"missing spine file", []zipEntry{mimetype, container, valid}, true, `spine item "ch1" is missing`},
+		{"duplicate id", []zipEntry{mimetype, container,
+			opf(`<item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>`, `<itemref idref="ch1"/>`), chapter},
+			false, `duplicate manifest id "ch1"`},
+		{"missing manifest file", []zipEntry{mimetype, container,
+			opf(`<item id="css" href="style.css" media-type="text/css"/>`, `<itemref idref="ch1"/>`), chapter},
+			false, "missing file OEBPS/style.css"},
+		{"no media-type", []zipEntry{mimetype, container,
+			opf(`<item id="css" href="ch1.xhtml"/>`, `<itemref idref="ch1"/>`), chapter},
+			false, `"css" has no media-type`},
+		{"non-core media-type", []zipEntry{mimetype, container,
+			opf(`<item id="doc" href="ch1.xhtml" media-type="application/msword"/>`, `<itemref idref="ch1"/>`), chapter},
+			false, "non-core media-type application/msword"},
+		{"non-core media-type with fallback", []zipEntry{mimetype, container,
+			opf(`<item id="doc" href="ch1.xhtml" media-type="application/msword" fallback="ch1"/>`, `<itemref idref="ch1"/>`), chapter},
+			false, ""},
+		{"core media-type with parameters", []zipEntry{mimetype, container,
+			opf(`<item id="a" href="ch1.xhtml" media-type="audio/mp4; codecs=&quot;mp4a.40.2&quot;"/>`, `<itemref idref="ch1"/>`), chapter},
+			false, ""},
+	}
+	dir := t.TempDir()
+	for i, tt := range tests {
+		path := filepath.Join(dir, tt.name+".epub")
+		writeRawZip(t, path, tt.entries)
+		book, err := openEpub(path)
+		if err != nil {
+			t.Errorf("%d %s: %s", i, tt.name, err)
+			continue
+		}
+		problems := book.Validate()
+		book.file.Close()
+		if tt.want == "" {
+			if len(problems) != 0 {
+				t.Errorf("%s: unexpected problems %v", tt.name, problems)
+			}
+			continue
+		}
+		found := false
+		for _, v := range problems {
+			if strings.Contains(v.Message, tt.want) {
+				found = true
+				if v.Fatal != tt.fatal {
+					t.Errorf("%s: %s has fatal %v, want %v", tt.name, v, v.Fatal, tt.fatal)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s: problems %v, want %q", tt.name, problems, tt.want)
+		}
+	}
+}
+
+func TestValidateMissingContainer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nocontainer.epub")
+	writeRawZip(t, path, []zipEntry{
+		{"mimetype", "application/epub+zip", zip.Store},
+		{"OEBPS/content.opf", validateOPF("", `<itemref idref="ch1"/>`), zip.Deflate},
+		{"OEBPS/ch1.xhtml", "<html/>", zip.Deflate},
+	})
+	_, err := readEpub(path)
+	var formatErr *FormatError
+	if !errors.As(err, &formatErr) || formatErr.Reason != "missing "+containerPath {
+		t.Errorf("opening: %v", err)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	book := &Epub{path: path, file: zr}
+	problems := book.Validate()
+	if len(problems) != 1 || !problems[0].Fatal || problems[0].Message != "missing "+containerPath {
+		t.Errorf("problems %v", problems)
+	}
+}
+
+func TestRejectInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nospine.epub")
+	writeRawZip(t, path, []zipEntry{
+		{"mimetype", "application/epub+zip", zip.Store},
+		{containerPath, containerXML, zip.Deflate},
+		{"OEBPS/content.opf", validateOPF("", ""), zip.Deflate},
+		{"OEBPS/ch1.xhtml", "<html/>", zip.Deflate},
+	})
+	defer func() { rejectInvalid = false }()
+
+	rejectInvalid = false
+	book, err := readEpub(path)
+	if err != nil {
+		t.Fatalf("without -rejectinvalid: %s", err)
+	}
+	warnings := book.OpdsMeta().Warnings
+	book.file.Close()
+	if len(warnings) != 1 || warnings[0] != "error: OEBPS/content.opf: spine is empty" {
+		t.Errorf("warnings %q", warnings)
+	}
+
+	rejectInvalid = true
+	if _, err = readEpub(path); err == nil || !strings.Contains(err.Error(), "spine is empty") {
+		t.Errorf("with -rejectinvalid: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"time"
+
+	"github.com/Pursuit92/gopds"
+)
+
+// Writer builds an epub archive. The OCF container requires the mimetype
+// entry to come first and be stored uncompressed, so NewWriter writes it
+// before anything else.
+type Writer struct {
+	zw *zip.Writer
+}
+
+func NewWriter(w io.Writer) (*Writer, error) {
+	zw := zip.NewWriter(w)
+	mt, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.WriteString(mt, "application/epub+zip")
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{zw}, nil
+}
+
+// Create adds a compressed entry to the archive.
+func (w *Writer) Create(name string) (io.Writer, error) {
+	return w.zw.CreateHeader(&zip.FileHeader{Name: name,
+		Method:   zip.Deflate,
+		Modified: time.Now()})
+}
+
+// Copy adds f from another archive without recompressing it.
+func (w *Writer) Copy(f *zip.File) error {
+	return w.zw.Copy(f)
+}
+
+func (w *Writer) WriteFile(name string, data []byte) error {
+	fw, err := w.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(data)
+	return err
+}
+
+func (w *Writer) Close() error {
+	return w.zw.Close()
+}
+
+// Chapter is one XHTML document of a generated book. Body holds the
+// markup that goes inside <body>.
+type Chapter struct {
+	Title string
+	Body  []byte
+}
+
+const containerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+// Generate writes a minimal EPUB 3 book, with an EPUB 2 NCX for older
+// readers, made up of the given chapters. An empty document still gets
+// one empty chapter, as the spine may not be empty.
+func Generate(out io.Writer, meta *gopds.OpdsMeta, chapters []Chapter) error {
+	if len(chapters) == 0 {
+		chapters = []Chapter{{Title: meta.Title}}
+	}
+	w, err := NewWriter(out)
+	if err != nil {
+		return err
+	}
+	id := "urn:uuid:" + gopds.Uuidgen()
+	lang := meta.Lang
+	if lang == "" {
+		lang = "en"
+	}
+	err = w.WriteFile("META-INF/container.xml", []byte(containerXML))
+	if err != nil {
+		return err
+	}
+
+	opf := &bytes.Buffer{}
+	fmt.Fprintf(opf, `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="bookid">%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:language>%s</dc:language>
+`, escape(id), escape(meta.Title), escape(lang))
+	m := &opfMeta{buf: opf, indent: "    ", dc: "dc", v3: true}
+	m.people("creator", meta.Authors)
+	m.people("contributor", meta.Contributors)
+	m.element("publisher", "", meta.Publisher)
+	m.element("date", "", meta.Issued)
+	m.element("description", "", meta.Summary)
+	m.element("rights", "", meta.Rights)
+	fmt.Fprintf(opf, `    <meta property="dcterms:modified">%s</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+`, time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	for i := range chapters {
+		fmt.Fprintf(opf, "    <item id=\"ch%d\" href=\"ch%d.xhtml\" media-type=\"application/xhtml+xml\"/>\n", i+1, i+1)
+	}
+	fmt.Fprintf(opf, "  </manifest>\n  <spine toc=\"ncx\">\n")
+	for i := range chapters {
+		fmt.Fprintf(opf, "    <itemref idref=\"ch%d\"/>\n", i+1)
+	}
+	fmt.Fprintf(opf, "  </spine>\n</package>\n")
+	err = w.WriteFile("OEBPS/content.opf", opf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	nav := &bytes.Buffer{}
+	ncx := &bytes.Buffer{}
+	docs := make([][]byte, len(chapters))
+	fmt.Fprintf(nav, `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>%s</title></head>
+<body>
+<nav epub:type="toc"><ol>
+`, escape(meta.Title))
+	fmt.Fprintf(ncx, `<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+<head><meta name="dtb:uid" content="%s"/></head>
+<docTitle><text>%s</text></docTitle>
+<navMap>
+`, escape(id), escape(meta.Title))
+	for i, v := range chapters {
+		title := chapterTitle(i, v)
+		fmt.Fprintf(nav, "<li><a href=\"ch%d.xhtml\">%s</a></li>\n", i+1, escape(title))
+		fmt.Fprintf(ncx, "<navPoint id=\"np%d\" playOrder=\"%d\"><navLabel><text>%s</text></navLabel><content src=\"ch%d.xhtml\"/></navPoint>\n",
+			i+1, i+1, escape(title), i+1)
+
+		ch := &bytes.Buffer{}
+		fmt.Fprintf(ch, `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>%s</title></head>
+<body>
+%s
+</body>
+</html>
+`, escape(title), v.Body)
+		docs[i] = ch.Bytes()
+	}
+	fmt.Fprintf(nav, "</ol></nav>\n</body>\n</html>\n")
+	fmt.Fprintf(ncx, "</navMap>\n</ncx>\n")
+	err = w.WriteFile("OEBPS/nav.xhtml", nav.Bytes())
+	if err != nil {
+		return err
+	}
+	err = w.WriteFile("OEBPS/toc.ncx", ncx.Bytes())
+	if err != nil {
+		return err
+	}
+	for i, v := range docs {
+		err = w.WriteFile(fmt.Sprintf("OEBPS/ch%d.xhtml", i+1), v)
+		if err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+func escape(s string) string {
+	return html.EscapeString(s)
+}
+
+func chapterTitle(i int, ch Chapter) string {
+	if ch.Title == "" {
+		return fmt.Sprintf("Chapter %d", i+1)
+	}
+	return ch.Title
+}
+
+// GeneratedToc is the table of contents of the book Generate writes for
+// chapters.
+func GeneratedToc(chapters []Chapter) []*gopds.OpdsTocEntry {
+	toc := []*gopds.OpdsTocEntry{}
+	for i, v := range chapters {
+		toc = append(toc, &gopds.OpdsTocEntry{Title: chapterTitle(i, v),
+			Href: fmt.Sprintf("OEBPS/ch%d.xhtml", i+1)})
+	}
+	return toc
+}
@@ -0,0 +1,225 @@
+package fb2
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Pursuit92/gopds"
+)
+
+const (
+	Fb2Type    = "application/x-fictionbook+xml"
+	Fb2ZipType = "application/x-zip-compressed-fb2"
+)
+
+var (
+	tagExp   *regexp.Regexp = regexp.MustCompile(`<[^>]*>`)
+	paraExp  *regexp.Regexp = regexp.MustCompile(`</(p|v|subtitle)>`)
+	spaceExp *regexp.Regexp = regexp.MustCompile(`[ \t\r]+`)
+)
+
+type Fb2 struct {
+	path     string
+	bookType string
+	*Description
+	cover     []byte
+	coverType string
+}
+
+func ReadFb2(path string) (gopds.Ebook, error) {
+	safePath := filepath.FromSlash(path)
+	file, err := os.Open(safePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readFb2(safePath, Fb2Type, file)
+}
+
+func ReadFb2Zip(path string) (gopds.Ebook, error) {
+	safePath := filepath.FromSlash(path)
+	arc, err := zip.OpenReader(safePath)
+	if err != nil {
+		return nil, err
+	}
+	defer arc.Close()
+	for _, v := range arc.File {
+		if strings.HasSuffix(strings.ToLower(v.Name), ".fb2") {
+			rc, err := v.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return readFb2(safePath, Fb2ZipType, rc)
+		}
+	}
+	return nil, errors.New("No fb2 file found in " + path)
+}
+
+func readFb2(path, bookType string, r io.Reader) (*Fb2, error) {
+	book := &Fb2{path: path, bookType: bookType}
+	err := book.parse(r)
+	if err != nil {
+		return nil, err
+	}
+	if book.Description == nil {
+		return nil, errors.New("No description found in " + path)
+	}
+	return book, nil
+}
+
+// parse decodes the description and the cover binary, skipping over the
+// body and any other embedded images.
+func (book *Fb2) parse(r io.Reader) error {
+	dec := xml.NewDecoder(r)
+	dec.CharsetReader = gopds.CharsetReader
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "description":
+			book.Description = &Description{}
+			err = dec.DecodeElement(book.Description, &se)
+		case "body":
+			err = dec.Skip()
+		case "binary":
+			bin := &Binary{}
+			err = dec.DecodeElement(bin, &se)
+			if err == nil && book.Description != nil && "#"+bin.Id == book.coverHref() {
+				book.cover, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(bin.Data), ""))
+				book.coverType = bin.ContentType
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (book *Fb2) coverHref() string {
+	for _, v := range book.TitleInfo.Coverpage {
+		if href := v.Href(); href != "" {
+			return href
+		}
+	}
+	return ""
+}
+
+func (author Author) Name() string {
+	parts := []string{}
+	for _, v := range []string{author.FirstName, author.MiddleName, author.LastName} {
+		if v = strings.TrimSpace(v); v != "" {
+			parts = append(parts, v)
+		}
+	}
+	if len(parts) == 0 {
+		return strings.TrimSpace(author.Nickname)
+	}
+	return strings.Join(parts, " ")
+}
+
+// FileAs gives the "Last, First Middle" sort form of the name.
+func (author Author) FileAs() string {
+	last := strings.TrimSpace(author.LastName)
+	rest := strings.TrimSpace(strings.TrimSpace(author.FirstName) + " " + strings.TrimSpace(author.MiddleName))
+	if last == "" || rest == "" {
+		return author.Name()
+	}
+	return last + ", " + rest
+}
+
+func (a Annotation) Text() string {
+	text := paraExp.ReplaceAllString(a.Inner, "\n")
+	text = html.UnescapeString(tagExp.ReplaceAllString(text, ""))
+	lines := []string{}
+	for _, v := range strings.Split(text, "\n") {
+		if v = strings.TrimSpace(spaceExp.ReplaceAllString(v, " ")); v != "" {
+			lines = append(lines, v)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (book Fb2) Cover() io.ReadCloser {
+	return ioutil.NopCloser(bytes.NewReader(book.cover))
+}
+
+// Thumb returns nil: the server makes thumbnails from the cover.
+func (book Fb2) Thumb() io.ReadCloser {
+	return nil
+}
+
+func (book Fb2) Book() io.ReadCloser {
+	file, _ := os.Open(book.path)
+	return file
+}
+
+func (book Fb2) OpdsMeta() *gopds.OpdsMeta {
+	title := book.TitleInfo
+	meta := &gopds.OpdsMeta{Title: strings.TrimSpace(title.BookTitle),
+		Publisher: strings.TrimSpace(book.PublishInfo.Publisher),
+		Issued:    title.Date.Value,
+		Lang:      strings.TrimSpace(title.Lang),
+		Summary:   title.Annotation.Text(),
+		Subjects:  title.Genres,
+		Category:  strings.Join(title.Genres, ", "),
+		BookType:  book.bookType,
+		Cover:     book.cover != nil,
+		CoverType: book.coverType}
+	if meta.Title == "" {
+		meta.Title = strings.TrimSpace(book.PublishInfo.BookName)
+	}
+	if meta.Issued == "" {
+		meta.Issued = strings.TrimSpace(title.Date.Text)
+	}
+	if meta.Issued == "" {
+		meta.Issued = strings.TrimSpace(book.PublishInfo.Year)
+	}
+
+	for _, v := range title.Authors {
+		if name := v.Name(); name != "" {
+			meta.Authors = append(meta.Authors, &gopds.OpdsAuthor{Name: name,
+				FileAs: v.FileAs(),
+				Uri:    strings.TrimSpace(v.HomePage)})
+		}
+	}
+	if isbn := strings.TrimSpace(book.PublishInfo.ISBN); isbn != "" {
+		meta.Identifiers = []*gopds.OpdsIdentifier{{Scheme: "ISBN", Value: isbn}}
+	}
+
+	sequences := append(title.Sequences, book.PublishInfo.Sequences...)
+	for _, v := range sequences {
+		if v.Name != "" {
+			meta.Series = strings.TrimSpace(v.Name)
+			meta.SeriesIndex, _ = strconv.ParseFloat(strings.TrimSpace(v.Number), 64)
+			break
+		}
+	}
+	return meta
+}
+
+func (book *Fb2) Close() {
+	os.Remove(book.path)
+}
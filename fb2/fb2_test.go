@@ -0,0 +1,72 @@
+package fb2
+
+import (
+	"strings"
+	"testing"
+)
+
+// testFb2 is a FictionBook description in the given encoding, with the
+// title, author and annotation already encoded to match.
+func testFb2(encoding, title, first, last, annotation string) string {
+	return `<?xml version="1.0" encoding="` + encoding + `"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0" xmlns:l="http://www.w3.org/1999/xlink">
+<description>
+<title-info>
+<genre>sf</genre><genre>adventure</genre>
+<author><first-name>` + first + `</first-name><last-name>` + last + `</last-name></author>
+<book-title>` + title + `</book-title>
+<annotation><p>` + annotation + `</p><p>&nbsp;Two</p></annotation>
+<lang>ru</lang>
+<sequence name="Noon" number="3"/>
+</title-info>
+</description>
+<body><section><p>` + annotation + `</p></section></body>
+</FictionBook>`
+}
+
+func TestParseCharsets(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"utf-8", testFb2("UTF-8", "Пикник", "Аркадий", "Стругацкий", "Зона")},
+		{"windows-1251", testFb2("windows-1251",
+			"\xcf\xe8\xea\xed\xe8\xea",
+			"\xc0\xf0\xea\xe0\xe4\xe8\xe9",
+			"\xd1\xf2\xf0\xf3\xe3\xe0\xf6\xea\xe8\xe9",
+			"\xc7\xee\xed\xe0")},
+		{"koi8-r", testFb2("koi8-r",
+			"\xf0\xc9\xcb\xce\xc9\xcb",
+			"\xe1\xd2\xcb\xc1\xc4\xc9\xca",
+			"\xf3\xd4\xd2\xd5\xc7\xc1\xc3\xcb\xc9\xca",
+			"\xfa\xcf\xce\xc1")},
+	}
+	for _, tt := range tests {
+		book, err := readFb2("test.fb2", Fb2Type, strings.NewReader(tt.doc))
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		meta := book.OpdsMeta()
+		if meta.Title != "Пикник" {
+			t.Errorf("%s: title %q", tt.name, meta.Title)
+		}
+		if len(meta.Authors) != 1 || meta.Authors[0].Name != "Аркадий Стругацкий" ||
+			meta.Authors[0].FileAs != "Стругацкий, Аркадий" {
+			t.Errorf("%s: authors %+v", tt.name, meta.Authors)
+		}
+		if meta.Summary != "Зона\nTwo" {
+			t.Errorf("%s: summary %q", tt.name, meta.Summary)
+		}
+		if meta.Series != "Noon" || meta.SeriesIndex != 3 || len(meta.Subjects) != 2 {
+			t.Errorf("%s: series %q %v, subjects %v", tt.name, meta.Series, meta.SeriesIndex, meta.Subjects)
+		}
+	}
+}
+
+func TestParseUnknownCharset(t *testing.T) {
+	_, err := readFb2("test.fb2", Fb2Type, strings.NewReader(testFb2("x-mac-klingon", "T", "A", "B", "C")))
+	if err == nil {
+		t.Error("parsed a book in an unknown charset")
+	}
+}
@@ -0,0 +1,73 @@
+package fb2
+
+import "encoding/xml"
+
+type Description struct {
+	TitleInfo   TitleInfo   `xml:"title-info"`
+	PublishInfo PublishInfo `xml:"publish-info"`
+}
+
+type TitleInfo struct {
+	Genres     []string   `xml:"genre"`
+	Authors    []Author   `xml:"author"`
+	BookTitle  string     `xml:"book-title"`
+	Annotation Annotation `xml:"annotation"`
+	Keywords   string     `xml:"keywords"`
+	Date       Date       `xml:"date"`
+	Coverpage  []Image    `xml:"coverpage>image"`
+	Lang       string     `xml:"lang"`
+	Sequences  []Sequence `xml:"sequence"`
+}
+
+type PublishInfo struct {
+	BookName  string     `xml:"book-name"`
+	Publisher string     `xml:"publisher"`
+	City      string     `xml:"city"`
+	Year      string     `xml:"year"`
+	ISBN      string     `xml:"isbn"`
+	Sequences []Sequence `xml:"sequence"`
+}
+
+type Author struct {
+	FirstName  string `xml:"first-name"`
+	MiddleName string `xml:"middle-name"`
+	LastName   string `xml:"last-name"`
+	Nickname   string `xml:"nickname"`
+	HomePage   string `xml:"home-page"`
+	Email      string `xml:"email"`
+}
+
+type Annotation struct {
+	Inner string `xml:",innerxml"`
+}
+
+type Date struct {
+	Value string `xml:"value,attr"`
+	Text  string `xml:",chardata"`
+}
+
+// Image references a binary by "#id". The xlink prefix isn't always
+// declared properly, so the href is picked out of the raw attributes.
+type Image struct {
+	Attrs []xml.Attr `xml:",any,attr"`
+}
+
+type Sequence struct {
+	Name   string `xml:"name,attr"`
+	Number string `xml:"number,attr"`
+}
+
+type Binary struct {
+	Id          string `xml:"id,attr"`
+	ContentType string `xml:"content-type,attr"`
+	Data        string `xml:",chardata"`
+}
+
+func (img Image) Href() string {
+	for _, v := range img.Attrs {
+		if v.Name.Local == "href" {
+			return v.Value
+		}
+	}
+	return ""
+}
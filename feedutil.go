@@ -1,9 +1,24 @@
 package gopds
 
-func createNavLinks(feed *OpdsEntry) {
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Most table of contents entries listed in an entry's content.
+const maxTocLines = 40
+
+// createNavLinks links a navigation entry to the feed of type feedType it
+// stands for.
+func createNavLinks(feed *OpdsEntry,feedType byte) {
 	// <link type="application/atom+xml" href="http://manybooks.net/opds/new_titles.php"/>
 	link := &OpdsLink{Href: "/catalog/" + feed.Category,
-		Type: "application/atom+xml"}
+		Type: kindType(feedType),
+		Rel: "subsection"}
 	if feed.Links == nil {
 		feed.Links = []*OpdsLink{link}
 	} else {
@@ -22,27 +37,67 @@ func addSearchLink(feed *OpdsFeed) {
 	}
 }
 
-func createFeedLinks(feed *OpdsFeed,name string) {
-	var feedType string
-	switch feed.Type {
-	case Nav:
-		feedType = "application/atom+xml;profile=opds-catalog;kind=navigation"
+func feedLinkType(feed *OpdsFeed) string {
+	return kindType(feed.Type)
+}
+
+// kindType is the link type of feeds of type feedType.
+func kindType(feedType byte) string {
+	switch feedType {
+	case Nav,AuthorIndex,Shelves:
+		return "application/atom+xml;profile=opds-catalog;kind=navigation"
 	case Acq:
-		feedType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+		return "application/atom+xml;profile=opds-catalog;kind=acquisition"
 	default:
-		feedType = "application/atom+xml"
+		return "application/atom+xml"
 	}
+}
+
+// feedBase is the address of the first page of the requested feed.
+func feedBase(req *FeedRequest) string {
+	name := req.Name
 	var base string
 	if len(name) >= 7 && name[:7] == "search:" {
-		base = "/search?q="+name[7:]
+		base = "/search?q="+url.QueryEscape(name[7:])
 	} else if len(name) >= 5 && name[:5] == "book:" {
 		base = "/book?id="+name[5:]
+	} else if len(name) >= 7 && name[:7] == "author:" {
+		base = "/catalog/"+url.PathEscape(name)
 	} else {
 		base = "/catalog/"+name
 	}
-	selfLink := &OpdsLink{Type: feedType,Href:base,Rel: "self"}
+	if req.Sort != "" && base[:9] == "/catalog/" {
+		base += "/sort/"+req.Sort
+	}
+	return base
+}
+
+func pageHref(base string,page int) string {
+	if page <= 1 {
+		return base
+	}
+	if strings.Contains(base,"?") {
+		return base+"&page="+strconv.Itoa(page)
+	}
+	return base+"?page="+strconv.Itoa(page)
+}
+
+func createFeedLinks(feed *OpdsFeed,req *FeedRequest) {
+	selfLink := &OpdsLink{Type: feedLinkType(feed),Href: pageHref(feedBase(req),req.Page),Rel: "self"}
 	newLinks := []*OpdsLink{selfLink}
 
+	// start at the root, up to the parent
+	if len(feed.Crumbs) > 0 {
+		start,up := *feed.Crumbs[0],*feed.Crumbs[len(feed.Crumbs)-1]
+		start.Rel,up.Rel = "start","up"
+		newLinks = append(newLinks,&start,&up)
+	} else {
+		newLinks = append(newLinks,&OpdsLink{Rel: "start",
+			Href: "/catalog/root",
+			Type: kindType(Nav),
+			Title: feed.Title})
+	}
+
 	if feed.Links != nil {
 		feed.Links = append(feed.Links,newLinks...)
 	} else {
@@ -60,9 +115,11 @@ func createAcqLinks(entry *OpdsEntry) {
 		numLinks++
 	}
 
+	bookType := entry.bookType()
+
 	entry.Links = make([]*OpdsLink, numLinks)
 	linkNo := 0
-	entry.Links[linkNo] = &OpdsLink{Type: "application/epub+zip",
+	entry.Links[linkNo] = &OpdsLink{Type: bookType,
 	Href: "/get/books/" + entry.Id,
 	Rel: "http://opds-spec.org/acquisition"}
 	linkNo++
@@ -80,13 +137,96 @@ func createAcqLinks(entry *OpdsEntry) {
 	}
 }
 
+// createEntryLink links a partial entry to the book's complete entry.
+func createEntryLink(entry *OpdsEntry) {
+	entry.Links = append(entry.Links,&OpdsLink{Rel: "alternate",
+		Href: entryHref(entryId(entry)),
+		Type: EntryType,
+		Title: entry.Title})
+}
+
+// createCategories lists the book's subjects as Atom categories. Books
+// stored before subjects were kept apart only have them joined up in
+// Category.
+func createCategories(entry *OpdsEntry) {
+	subjects := entry.Subjects
+	if len(subjects) == 0 && entry.Category != "" {
+		subjects = strings.Split(entry.Category,", ")
+	}
+	entry.Categories = nil
+	for _,v := range subjects {
+		if v = strings.TrimSpace(v); v != "" {
+			entry.Categories = append(entry.Categories,&OpdsCategory{Term: v,Label: v})
+		}
+	}
+}
+
+// createTocContent lists the table of contents as the entry content, so
+// anthologies show what they contain before downloading.
+func createTocContent(entry *OpdsEntry) {
+	if entry.Content != nil || len(entry.Toc) == 0 {
+		return
+	}
+	buf := &bytes.Buffer{}
+	n := 0
+	writeTocList(buf,entry.Toc,0,&n)
+	entry.Content = &OpdsContent{Type: "html",Content: buf.String()}
+}
+
+// writeTocList writes the top two levels of toc as nested lists.
+func writeTocList(buf *bytes.Buffer,toc []*OpdsTocEntry,depth int,n *int) {
+	buf.WriteString("<ul>")
+	for _,v := range toc {
+		if *n >= maxTocLines {
+			buf.WriteString("<li>&#8230;</li>")
+			break
+		}
+		*n++
+		buf.WriteString("<li>"+html.EscapeString(v.Title))
+		if depth == 0 && len(v.Children) > 0 {
+			writeTocList(buf,v.Children,depth+1,n)
+		}
+		buf.WriteString("</li>")
+	}
+	buf.WriteString("</ul>")
+}
+
 func feedToEntry(f *OpdsFeedDB) *OpdsEntry {
 	entry := &OpdsEntry{OpdsMeta: &OpdsMeta{}}
 	entry.Id = f.Id
 	entry.Updated = f.Updated
-	entry.Author = f.Author
+	if f.Author != nil {
+		entry.Authors = []*OpdsAuthor{f.Author}
+	}
 	entry.Title = f.Title
 	entry.Category = f.Name
 	entry.Content = &OpdsContent{Content: f.Desc}
 	return entry
 }
+
+// windowEntries drops the books added, or updated for feeds sorted by
+// update, before the feed's window, and dates the feed by the newest one
+// so feed readers notice arrivals.
+func windowEntries(feed *OpdsFeed,dbFeed *OpdsFeedDB) {
+	when := func(e *OpdsEntry) string { return e.Added }
+	if dbFeed.Sort == SortUpdated {
+		when = func(e *OpdsEntry) string { return e.Updated }
+	}
+	start := time.Now().AddDate(0,0,-dbFeed.Window)
+	newest := time.Time{}
+	entries := []*OpdsEntry{}
+	for _,v := range feed.Entries {
+		t,err := time.Parse(time.RFC3339,when(v))
+		if err != nil || t.Before(start) {
+			continue
+		}
+		if t.After(newest) {
+			newest = t
+		}
+		entries = append(entries,v)
+	}
+	feed.Entries = entries
+	if !newest.IsZero() {
+		feed.Updated = newest.Format(time.RFC3339)
+	}
+}
@@ -0,0 +1,83 @@
+package gopds
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWindowEntries(t *testing.T) {
+	ago := func(days int) string {
+		return time.Now().AddDate(0, 0, -days).UTC().Format(time.RFC3339)
+	}
+	entry := func(id, updated, added string) *OpdsEntry {
+		return &OpdsEntry{Id: id, Updated: updated, Added: added, OpdsMeta: &OpdsMeta{}}
+	}
+	entries := []*OpdsEntry{
+		entry("recent", ago(1), ago(2)),
+		entry("edited", ago(3), ago(30)),
+		entry("old", ago(20), ago(40)),
+		entry("undated", ago(1), ""),
+		entry("bad", "yesterday", "yesterday"),
+	}
+	tests := []struct {
+		name    string
+		sort    byte
+		window  int
+		want    []string
+		updated string
+	}{
+		{"added", SortAdded, 7, []string{"recent"}, entries[0].Added},
+		{"updated", SortUpdated, 7, []string{"recent", "edited", "undated"}, entries[0].Updated},
+		{"wider", SortAdded, 35, []string{"recent", "edited"}, entries[0].Added},
+		{"title sort windows by added", SortTitle, 35, []string{"recent", "edited"}, entries[0].Added},
+		{"nothing new", SortAdded, 1, []string{}, "2000-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		feed := &OpdsFeed{OpdsCommon: &OpdsCommon{Updated: "2000-01-01T00:00:00Z"},
+			Entries: append([]*OpdsEntry{}, entries...)}
+		windowEntries(feed, &OpdsFeedDB{OpdsCommon: &OpdsCommon{}, Sort: tt.sort, Window: tt.window})
+		got := []string{}
+		for _, v := range feed.Entries {
+			got = append(got, v.Id)
+		}
+		if !reflect.DeepEqual(got, tt.want) || feed.Updated != tt.updated {
+			t.Errorf("%s: %v updated %s, want %v updated %s", tt.name, got, feed.Updated, tt.want, tt.updated)
+		}
+	}
+}
+
+func TestAddedMigration(t *testing.T) {
+	srv := newTestServer(t)
+	// books stored before Added existed only carry Updated
+	legacy := &OpdsEntry{Id: "legacy", Updated: "2020-05-01T00:00:00Z",
+		OpdsMeta: &OpdsMeta{Title: "Legacy", PartialMD5: "0123456789abcdef0123456789abcdef"}}
+	if err := srv.DB.Set("books", "legacy", legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.upgradeBooks(); err != nil {
+		t.Fatal(err)
+	}
+	book := &OpdsEntry{}
+	srv.DB.Get("books", "legacy", book)
+	if book.Added != legacy.Updated {
+		t.Errorf("upgraded book added %q, want %q", book.Added, legacy.Updated)
+	}
+
+	// edits move Updated but keep Added
+	if err := srv.updateBookDB("legacy", book.OpdsMeta); err != nil {
+		t.Fatal(err)
+	}
+	srv.DB.Get("books", "legacy", book)
+	if book.Added != legacy.Updated || book.Updated == legacy.Updated {
+		t.Errorf("edited book added %q, updated %q", book.Added, book.Updated)
+	}
+
+	if err := srv.updateBookDB("new", &OpdsMeta{Title: "New"}); err != nil {
+		t.Fatal(err)
+	}
+	srv.DB.Get("books", "new", book)
+	if book.Added == "" || book.Added != book.Updated {
+		t.Errorf("new book added %q, updated %q", book.Added, book.Updated)
+	}
+}
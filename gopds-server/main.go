@@ -3,25 +3,79 @@ package main
 import (
 	"flag"
 	"log"
+	"strings"
+	"github.com/Pursuit92/gopds/comic"
 	"github.com/Pursuit92/gopds/epub"
+	"github.com/Pursuit92/gopds/fb2"
+	"github.com/Pursuit92/gopds/mobi"
+	"github.com/Pursuit92/gopds/pdf"
+	"github.com/Pursuit92/gopds/txt"
 	"github.com/Pursuit92/gopds"
 )
 
 
 func main() {
-	autoadd := flag.String("autoadd","","Directory to watch for epubs")
+	autoadd := flag.String("autoadd","","Directory to watch for new books")
 	dataPath := flag.String("data",".gopds","Data directory")
 	port := flag.Int("port",8080,"Listen port")
+	flag.IntVar(&gopds.ThumbWidth,"thumbwidth",gopds.ThumbWidth,"Maximum width of generated thumbnails")
+	flag.IntVar(&gopds.ThumbHeight,"thumbheight",gopds.ThumbHeight,"Maximum height of generated thumbnails")
+	flag.BoolVar(&gopds.WriteBack,"writeback",false,"Rewrite stored books when their metadata is edited")
+	flag.IntVar(&gopds.PageSize,"pagesize",gopds.PageSize,"Entries per feed page, 0 for unpaginated feeds")
+	flag.BoolVar(&gopds.SyncRegistration,"syncregister",false,"Let KOReader register accounts through the kosync API, once an -admin exists")
+	admin := flag.String("admin","","Create this admin account (name:password) if it doesn't exist. The API changes nothing until an admin exists")
+	thumbFormat := flag.String("thumbformat","jpeg","Format of generated thumbnails (jpeg or png)")
 	flag.Parse()
+	gopds.ThumbFormat = "image/" + *thumbFormat
 
 	srv,err := gopds.NewServer(*dataPath,*autoadd)
 	if err != nil {
 		panic(err)
 	}
 
+	if *admin != "" {
+		name,password,_ := strings.Cut(*admin,":")
+		if _,err := srv.GetUser(name); err != nil {
+			err = srv.SetUser(name,password,gopds.RoleAdmin,nil)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
 	if *autoadd != "" {
 		srv.AutoAdd("epub",epub.ReadEpub)
 		srv.AutoAdd("b64",epub.AddKey("keystorage"))
+		srv.AutoAdd("cbz",comic.ReadCBZ)
+		srv.AutoAdd("cbr",comic.ReadCBR)
+		srv.AutoAdd("cb7",comic.ReadCB7)
+		srv.AutoAdd("pdf",pdf.ReadPdf)
+		srv.AutoAdd("fb2",fb2.ReadFb2)
+		srv.AutoAdd("fb2.zip",fb2.ReadFb2Zip)
+		srv.AutoAdd("mobi",mobi.ReadMobi)
+		srv.AutoAdd("azw",mobi.ReadMobi)
+		srv.AutoAdd("azw3",mobi.ReadAzw3)
+		srv.AutoAdd("txt",txt.ReadText)
+		srv.AutoAdd("md",txt.ReadMarkdown)
+		srv.AutoAdd("markdown",txt.ReadMarkdown)
+		srv.AutoAdd("html",txt.ReadHTML)
+		srv.AutoAdd("htm",txt.ReadHTML)
+	}
+
+	srv.PageSource(comic.CBZType,comic.OpenCBZPages)
+	srv.PageSource(comic.CBRType,comic.OpenCBRPages)
+	srv.PageSource(comic.CB7Type,comic.OpenCB7Pages)
+	srv.PageSource(pdf.PdfType,pdf.OpenPages)
+
+	srv.ResourceSource("application/epub+zip",epub.OpenResources)
+	srv.MetadataWriter("application/epub+zip",epub.WriteMeta)
+	srv.AddConversion(gopds.Conversion{Name: "kepub",
+		From: "application/epub+zip",
+		To: epub.KepubType,
+		Ext: ".kepub.epub",
+		Convert: epub.ToKepub})
+	for _,v := range txt.Conversions() {
+		srv.AddConversion(v)
 	}
 
 
@@ -0,0 +1,287 @@
+package gopds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Reading states of a book for one user. Books without a recorded state
+// are unread.
+const (
+	StatusUnread  = "unread"
+	StatusReading = "reading"
+	StatusRead    = "read"
+)
+
+var errStatus = errors.New("Status must be unread, reading or read")
+
+// ReadStatus is where a user is with a book.
+type ReadStatus struct {
+	Book    string
+	Status  string
+	Updated string
+}
+
+// Download records a user fetching a book.
+type Download struct {
+	User   string
+	Book   string
+	Format string
+	Time   string
+}
+
+func statusKey(user, book string) string {
+	return user + ":" + book
+}
+
+// GetStatus returns user's reading state of book.
+func (srv *Server) GetStatus(user, book string) *ReadStatus {
+	status := &ReadStatus{}
+	err := srv.DB.Get("status", statusKey(user, book), status)
+	if err != nil {
+		return &ReadStatus{Book: book, Status: StatusUnread}
+	}
+	return status
+}
+
+// SetStatus records user's reading state of book.
+func (srv *Server) SetStatus(user, book, status string) error {
+	switch status {
+	case StatusUnread:
+		return srv.DB.Del("status", statusKey(user, book))
+	case StatusReading, StatusRead:
+		return srv.DB.Set("status", statusKey(user, book), &ReadStatus{Book: book,
+			Status:  status,
+			Updated: time.Now().Format(time.RFC3339)})
+	}
+	return errStatus
+}
+
+// statuses lists user's recorded reading states.
+func (srv *Server) statuses(user string) ([]*ReadStatus, error) {
+	iter, err := srv.DB.NewIterator("status")
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Release()
+	out := []*ReadStatus{}
+	for iter.Next() {
+		if !strings.HasPrefix(string(iter.Key()), user+":") {
+			continue
+		}
+		status := &ReadStatus{}
+		if json.Unmarshal(iter.Value(), status) == nil {
+			out = append(out, status)
+		}
+	}
+	return out, iter.Error()
+}
+
+// recordDownload logs the request's user fetching book in format, the
+// stored format if empty. Resumed downloads and anonymous ones aren't
+// logged.
+func (srv *Server) recordDownload(r *http.Request, book, format string) {
+	user := UserFromRequest(r)
+	if user == nil || r.Method != "GET" || r.Header.Get("Range") != "" {
+		return
+	}
+	if format == "" {
+		entry := &OpdsEntry{}
+		if srv.DB.Get("books", book, entry) != nil {
+			return
+		}
+		format = entry.bookType()
+	}
+	now := time.Now().UTC()
+	// keys sort by user, then time
+	key := user.Name + ":" + now.Format("20060102150405.000000000") + ":" + book
+	srv.DB.Set("downloads", key, &Download{User: user.Name,
+		Book:   book,
+		Format: format,
+		Time:   now.Format(time.RFC3339)})
+}
+
+// Downloads lists user's downloads, newest first.
+func (srv *Server) Downloads(user string) ([]*Download, error) {
+	iter, err := srv.DB.NewIterator("downloads")
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Release()
+	out := []*Download{}
+	for iter.Next() {
+		if !strings.HasPrefix(string(iter.Key()), user+":") {
+			continue
+		}
+		d := &Download{}
+		if json.Unmarshal(iter.Value(), d) == nil {
+			out = append(out, d)
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, iter.Error()
+}
+
+// progressStatus marks the book a kosync progress report is about as
+// being read, or read once the end is reached.
+func (srv *Server) progressStatus(user string, p *Progress) error {
+	book, err := srv.bookByPartialMD5(p.Document)
+	if err != nil || book == nil {
+		return err
+	}
+	status := StatusReading
+	if p.Percentage >= 1 {
+		status = StatusRead
+	}
+	return srv.SetStatus(user, book.Id, status)
+}
+
+// A personalFeed is an acquisition feed of books picked for the user
+// asking for it.
+type personalFeed struct {
+	title, desc string
+	sort        byte
+	books       func(srv *Server, user string) ([]string, error)
+}
+
+var personalFeeds = map[string]*personalFeed{
+	"my:downloads": {"Recently Downloaded", "Books you downloaded, newest first", SortOrder,
+		(*Server).downloadedBooks},
+	"my:reading": {"Continue Reading", "Books you are reading", SortOrder,
+		(*Server).readingBooks},
+	"my:unread": {"Unread", "Books you haven't started", SortTitle,
+		(*Server).unreadBooks},
+}
+
+// personalFeedNames orders the personal feeds in the user's branch.
+var personalFeedNames = []string{"my:reading", "my:unread", "my:downloads"}
+
+func (srv *Server) downloadedBooks(user string) ([]string, error) {
+	downloads, err := srv.Downloads(user)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, v := range downloads {
+		if !containsString(ids, v.Book) {
+			ids = append(ids, v.Book)
+		}
+	}
+	return ids, nil
+}
+
+func (srv *Server) readingBooks(user string) ([]string, error) {
+	statuses, err := srv.statuses(user)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Updated > statuses[j].Updated
+	})
+	ids := []string{}
+	for _, v := range statuses {
+		if v.Status == StatusReading {
+			ids = append(ids, v.Book)
+		}
+	}
+	return ids, nil
+}
+
+func (srv *Server) unreadBooks(user string) ([]string, error) {
+	statuses, err := srv.statuses(user)
+	if err != nil {
+		return nil, err
+	}
+	started := make(map[string]bool)
+	for _, v := range statuses {
+		started[v.Book] = true
+	}
+	books, err := srv.allBooks()
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, v := range books {
+		if !started[v.Id] {
+			ids = append(ids, v.Id)
+		}
+	}
+	return ids, nil
+}
+
+// getPersonalFeed builds the named personal feed for user, or returns nil
+// if there is no such feed.
+func (srv *Server) getPersonalFeed(name string, user *User) (*OpdsFeedDB, error) {
+	list, ok := personalFeeds[name]
+	if !ok {
+		return nil, nil
+	}
+	feed := &OpdsFeedDB{OpdsCommon: &OpdsCommon{
+		Id:    "urn:uuid:" + Uuidgen(),
+		Type:  Acq,
+		Title: list.title,
+		Name:  name},
+		Desc:    list.desc,
+		Sort:    list.sort,
+		Entries: []string{}}
+	if user == nil {
+		return feed, nil
+	}
+	entries, err := list.books(srv, user.Name)
+	if err != nil {
+		return nil, err
+	}
+	feed.Entries = entries
+	return feed, nil
+}
+
+func (srv *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	user := UserFromRequest(r)
+	if user == nil {
+		http.Error(w, errNoAccount.Error(), 400)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/")
+	if exists, _ := srv.DB.Exists("books", id); !exists {
+		http.Error(w, "Book not found", 404)
+		return
+	}
+	switch r.Method {
+	case "PUT":
+		update := &ReadStatus{}
+		err := json.NewDecoder(r.Body).Decode(update)
+		if err == nil {
+			err = srv.SetStatus(user.Name, id, update.Status)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	case "DELETE":
+		srv.SetStatus(user.Name, id, StatusUnread)
+	}
+	out, _ := json.MarshalIndent(srv.GetStatus(user.Name, id), "", "  ")
+	fmt.Fprintf(w, "%s", out)
+}
+
+func (srv *Server) handleDownloads(w http.ResponseWriter, r *http.Request) {
+	user := UserFromRequest(r)
+	if user == nil {
+		http.Error(w, errNoAccount.Error(), 400)
+		return
+	}
+	downloads, err := srv.Downloads(user.Name)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	out, _ := json.MarshalIndent(downloads, "", "  ")
+	fmt.Fprintf(w, "%s", out)
+}
@@ -0,0 +1,97 @@
+package gopds
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// storeTestBook stores a book file holding data the way AddBook does.
+func storeTestBook(t *testing.T, srv *Server, id, data string) *OpdsMeta {
+	err := os.WriteFile(filepath.Join(srv.Files, "books", id), []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := &OpdsMeta{Title: id}
+	srv.setPartialMD5(id, meta)
+	if err = srv.updateBookDB(id, meta); err != nil {
+		t.Fatal(err)
+	}
+	return meta
+}
+
+func TestProgressStatus(t *testing.T) {
+	srv := newTestServer(t)
+	one := storeTestBook(t, srv, "one", "first book").PartialMD5
+	two := storeTestBook(t, srv, "two", "second book").PartialMD5
+	tests := []struct {
+		document   string
+		percentage float64
+		book, want string
+	}{
+		{one, 0.5, "one", StatusReading},
+		{two, 1, "two", StatusRead},
+		{one, 1, "one", StatusRead},
+		{"0123456789abcdef0123456789abcdef", 0.5, "one", StatusRead},
+	}
+	for _, tt := range tests {
+		err := srv.progressStatus("bob", &Progress{Document: tt.document, Percentage: tt.percentage})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := srv.GetStatus("bob", tt.book).Status; got != tt.want {
+			t.Errorf("%s at %v: %s is %s, want %s", tt.document, tt.percentage, tt.book, got, tt.want)
+		}
+	}
+}
+
+func TestPartialMD5Index(t *testing.T) {
+	srv := newTestServer(t)
+	find := func(sum string) string {
+		book, err := srv.bookByPartialMD5(sum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if book == nil {
+			return ""
+		}
+		return book.Id
+	}
+
+	meta := storeTestBook(t, srv, "book", "original")
+	old := meta.PartialMD5
+	if got := find(old); got != "book" {
+		t.Errorf("stored book found as %q", got)
+	}
+
+	// rewriting the file moves the book to its new hash
+	os.WriteFile(filepath.Join(srv.Files, "books", "book"), []byte("rewritten"), 0644)
+	srv.setPartialMD5("book", meta)
+	srv.updateBookDB("book", meta)
+	if got := find(old); got != "" {
+		t.Errorf("old hash still finds %q", got)
+	}
+	if got := find(meta.PartialMD5); got != "book" {
+		t.Errorf("new hash finds %q", got)
+	}
+
+	if err := srv.DelBook("book"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := srv.DB.Exists("partialmd5", meta.PartialMD5); ok {
+		t.Error("deleted book is still indexed")
+	}
+
+	// books hashed before the index get indexed on upgrade
+	legacy := &OpdsMeta{Title: "legacy", PartialMD5: "0123456789abcdef0123456789abcdef"}
+	srv.updateBookDB("legacy", legacy)
+	if got := find(legacy.PartialMD5); got != "" {
+		t.Errorf("unindexed book found as %q", got)
+	}
+	if err := srv.upgradeBooks(); err != nil {
+		t.Fatal(err)
+	}
+	if got := find(legacy.PartialMD5); got != "legacy" {
+		t.Errorf("upgraded book found as %q", got)
+	}
+}
@@ -0,0 +1,250 @@
+package gopds
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Labels for the download buttons of the formats we serve.
+var formatNames = map[string]string{
+	"application/epub+zip":             "EPUB",
+	"application/kepub+zip":            "Kobo EPUB",
+	"application/pdf":                  "PDF",
+	"application/x-mobipocket-ebook":   "MOBI",
+	"application/vnd.amazon.ebook":     "AZW3",
+	"application/x-fictionbook+xml":    "FB2",
+	"application/x-zip-compressed-fb2": "FB2 (zip)",
+	"application/vnd.comicbook+zip":    "CBZ",
+	"application/vnd.comicbook-rar":    "CBR",
+	"application/x-cb7":                "CB7",
+	"text/plain":                       "Text",
+	"text/markdown":                    "Markdown",
+	"text/html":                        "HTML",
+}
+
+// wantsHTML picks the HTML catalog for browsers, which ask for text/html
+// first. OPDS clients ask for Atom or anything.
+func wantsHTML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	html := strings.Index(accept, "text/html")
+	atom := strings.Index(accept, "application/atom+xml")
+	return html >= 0 && (atom < 0 || html < atom)
+}
+
+func entryId(e *OpdsEntry) string {
+	return strings.TrimPrefix(e.Id, "urn:uuid:")
+}
+
+func linksByRel(e *OpdsEntry, rel string) []*OpdsLink {
+	links := []*OpdsLink{}
+	for _, v := range e.Links {
+		if v.Rel == rel {
+			links = append(links, v)
+		}
+	}
+	return links
+}
+
+func formatName(mimeType string) string {
+	if name, ok := formatNames[mimeType]; ok {
+		return name
+	}
+	return mimeType
+}
+
+func authorNames(people []*OpdsAuthor) string {
+	names := []string{}
+	for _, v := range people {
+		names = append(names, v.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+var htmlFuncs = template.FuncMap{
+	"id":      entryId,
+	"format":  formatName,
+	"authors": authorNames,
+	"acquisitions": func(e *OpdsEntry) []*OpdsLink {
+		return linksByRel(e, "http://opds-spec.org/acquisition")
+	},
+	"thumb": func(e *OpdsEntry) string {
+		if e.Cover {
+			return "/cover/" + entryId(e) + "?width=160&height=240"
+		}
+		if e.Thumb {
+			return "/get/thumbs/" + entryId(e)
+		}
+		return ""
+	},
+	"pathEscape": url.PathEscape,
+}
+
+const htmlLayout = `{{define "top"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{with .Atom}}<link rel="alternate" type="application/atom+xml" href="{{.}}" title="{{$.Title}}">{{end}}
+<style>
+body { font-family: sans-serif; margin: 0 auto; max-width: 60em; padding: 0 1em; }
+header { display: flex; justify-content: space-between; align-items: center; border-bottom: 1px solid #ccc; }
+header a { color: inherit; text-decoration: none; }
+ul.nav { list-style: none; padding: 0; }
+ul.nav li { padding: 0.5em 0; border-bottom: 1px solid #eee; }
+.grid { display: flex; flex-wrap: wrap; gap: 1em; }
+.book { width: 160px; }
+.book img, .cover { width: 160px; height: 240px; object-fit: contain; background: #eee; display: block; }
+.cover { display: flex; align-items: center; justify-content: center; text-align: center; color: #666; }
+.book .title { font-weight: bold; }
+.small { font-size: 0.85em; color: #555; }
+.button { display: inline-block; padding: 0.2em 0.6em; margin: 0.2em 0.2em 0 0; border: 1px solid #888; border-radius: 3px; text-decoration: none; color: inherit; }
+.sort a, .pages a { margin-right: 0.5em; }
+.crumbs { font-size: 0.9em; }
+.detail { display: flex; gap: 2em; flex-wrap: wrap; }
+.detail img { max-width: 300px; }
+dt { font-weight: bold; }
+</style>
+</head>
+<body>
+<header>
+<h1><a href="/catalog">{{.Title}}</a></h1>
+<form action="/search"><input type="search" name="q" placeholder="Search"> <input type="submit" value="Search"></form>
+</header>
+{{end}}
+{{define "bottom"}}</body>
+</html>
+{{end}}
+{{define "downloads"}}{{range acquisitions .}}<a class="button" href="{{.Href}}">{{format .Type}}</a>{{end}}{{end}}
+`
+
+var feedTemplate = template.Must(template.New("feed").Funcs(htmlFuncs).Parse(htmlLayout + `
+{{template "top" .}}
+{{with .Feed.Crumbs}}<p class="crumbs">{{range .}}<a href="{{.Href}}">{{.Title}}</a> &rsaquo; {{end}}{{$.Feed.Title}}</p>{{end}}
+{{if .Sorts}}<p class="sort">Sort by: {{range .Sorts}}{{if eq . $.Sort}}<b>{{.}}</b>{{else}}<a href="{{$.SortBase}}/sort/{{.}}">{{.}}</a>{{end}} {{end}}</p>{{end}}
+{{if .Books}}
+<div class="grid">
+{{range .Feed.Entries}}<div class="book">
+<a href="/book?id={{id .}}">{{with thumb .}}<img src="{{.}}" alt="">{{else}}<span class="cover">{{.Title}}</span>{{end}}</a>
+<div class="title"><a href="/book?id={{id .}}">{{.Title}}</a></div>
+<div class="small">{{authors .Authors}}</div>
+{{template "downloads" .}}
+</div>
+{{end}}
+</div>
+{{else}}
+<ul class="nav">
+{{range .Feed.Entries}}<li><a href="{{with .Links}}{{(index . 0).Href}}{{end}}">{{.Title}}</a>{{with .Content}} <span class="small">{{.Content}}</span>{{end}}</li>
+{{end}}
+</ul>
+{{end}}
+{{if not .Feed.Entries}}<p>Nothing here yet.</p>{{end}}
+<p class="pages">{{with .First}}<a href="{{.}}">&laquo; First</a>{{end}}{{with .Previous}}<a href="{{.}}">&lsaquo; Previous</a>{{end}}{{with .Next}}<a href="{{.}}">Next &rsaquo;</a>{{end}}{{with .Last}}<a href="{{.}}">Last &raquo;</a>{{end}}</p>
+{{template "bottom"}}`))
+
+var bookTemplate = template.Must(template.New("book").Funcs(htmlFuncs).Parse(htmlLayout + `
+{{template "top" .}}
+{{with .Entry}}
+<div class="detail">
+{{if .Cover}}<div><img src="/cover/{{id .}}?width=300&amp;height=450" alt=""></div>{{end}}
+<div>
+<h2>{{.Title}}</h2>
+<p>{{range $i, $a := .Authors}}{{if $i}}, {{end}}<a href="/catalog/{{pathEscape (print "author:" $a.Name)}}">{{$a.Name}}</a>{{end}}</p>
+<dl>
+{{with .Contributors}}<dt>Contributors</dt><dd>{{range $i, $a := .}}{{if $i}}, {{end}}{{$a.Name}}{{with $a.Role}} ({{.}}){{end}}{{end}}</dd>{{end}}
+{{with .Series}}<dt>Series</dt><dd>{{.}}{{with $.Entry.SeriesIndex}} #{{.}}{{end}}</dd>{{end}}
+{{with .Publisher}}<dt>Publisher</dt><dd>{{.}}</dd>{{end}}
+{{with .Issued}}<dt>Published</dt><dd>{{.}}</dd>{{end}}
+{{with .Added}}<dt>Added</dt><dd>{{.}}</dd>{{end}}
+{{with .Lang}}<dt>Language</dt><dd>{{.}}</dd>{{end}}
+{{with .Category}}<dt>Subjects</dt><dd>{{.}}</dd>{{end}}
+{{with .Identifiers}}<dt>Identifiers</dt><dd>{{range .}}{{.Value}} {{end}}</dd>{{end}}
+</dl>
+<p>{{template "downloads" .}}{{if $.Readable}}<a class="button" href="/read/{{id .}}">Read online</a>{{end}}</p>
+</div>
+</div>
+{{with .Summary}}<p>{{.}}</p>{{end}}
+{{with .Toc}}<h3>Contents</h3>{{template "toc" .}}{{end}}
+{{end}}
+{{template "bottom"}}
+{{define "toc"}}<ul>{{range .}}<li>{{.Title}}{{with .Children}}{{template "toc" .}}{{end}}</li>{{end}}</ul>{{end}}`))
+
+type htmlFeedPage struct {
+	Title string
+	// Atom is the feed's address for feed readers.
+	Atom string
+	Feed *OpdsFeed
+	// Books is set for acquisition feeds, shown as a cover grid.
+	Books                       bool
+	Sort                        string
+	SortBase                    string
+	Sorts                       []string
+	First, Previous, Next, Last string
+}
+
+func feedLinkHref(feed *OpdsFeed, rel string) string {
+	for _, v := range feed.Links {
+		if v.Rel == rel {
+			return v.Href
+		}
+	}
+	return ""
+}
+
+func (srv *Server) serveHTMLFeed(w http.ResponseWriter, r *http.Request, req *FeedRequest) {
+	feed, err := srv.Feed(req)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	page := &htmlFeedPage{Title: feed.Title,
+		Atom:     feedBase(&FeedRequest{Name: req.Name, Sort: req.Sort}),
+		Feed:     feed,
+		Books:    feed.Type == Acq || feed.Type == Search,
+		Sort:     req.Sort,
+		First:    feedLinkHref(feed, "first"),
+		Previous: feedLinkHref(feed, "previous"),
+		Next:     feedLinkHref(feed, "next"),
+		Last:     feedLinkHref(feed, "last")}
+	if feed.Type == Acq {
+		page.SortBase = feedBase(&FeedRequest{Name: req.Name})
+		page.Sorts = []string{"title", "author", "series", "added", "updated"}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = feedTemplate.Execute(w, page)
+	if err != nil {
+		log.Printf("Error: rendering %s: %s", req.Name, err.Error())
+	}
+}
+
+type htmlBookPage struct {
+	Title    string
+	Atom     string
+	Entry    *OpdsEntry
+	Readable bool
+}
+
+// handleBookPage shows the details of the book given by the id parameter.
+func (srv *Server) handleBookPage(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	book := &OpdsEntry{}
+	err := srv.DB.Get("books", id, book)
+	if err != nil || id == "" {
+		http.Error(w, "Book not found", 404)
+		return
+	}
+	srv.createBookLinks(book)
+	bookType := book.bookType()
+	_, readable := srv.resources[bookType]
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = bookTemplate.Execute(w, &htmlBookPage{Title: book.Title,
+		Atom:     entryHref(id),
+		Entry:    book,
+		Readable: readable})
+	if err != nil {
+		log.Printf("Error: rendering book %s: %s", id, err.Error())
+	}
+}
@@ -0,0 +1,218 @@
+package gopds
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	_ "image/gif"
+)
+
+var (
+	// Bounding box and format used for generated thumbnails.
+	ThumbWidth  int    = 160
+	ThumbHeight int    = 240
+	ThumbFormat string = "image/jpeg"
+)
+
+// Largest size the cover resize endpoint will produce.
+const maxResize = 2048
+
+// ScaleImage shrinks img to fit within maxWidth x maxHeight, preserving the
+// aspect ratio. A zero bound is unconstrained. Images that already fit are
+// returned untouched.
+func ScaleImage(img image.Image, maxWidth, maxHeight int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return img
+	}
+	newW, newH := w, h
+	if maxWidth > 0 && newW > maxWidth {
+		newH = newH * maxWidth / newW
+		newW = maxWidth
+	}
+	if maxHeight > 0 && newH > maxHeight {
+		newW = newW * maxHeight / newH
+		newH = maxHeight
+	}
+	if newW < 1 {
+		newW = 1
+	}
+	if newH < 1 {
+		newH = 1
+	}
+	if newW == w && newH == h {
+		return img
+	}
+
+	// Box filter: every destination pixel is the average of the source
+	// pixels that map onto it.
+	dst := image.NewRGBA(image.Rect(0, 0, newW, newH))
+	for y := 0; y < newH; y++ {
+		y0 := bounds.Min.Y + y*h/newH
+		y1 := bounds.Min.Y + (y+1)*h/newH
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < newW; x++ {
+			x0 := bounds.Min.X + x*w/newW
+			x1 := bounds.Min.X + (x+1)*w/newW
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// EncodeImage writes img in the given format ("image/png" or "image/jpeg")
+// and returns the MIME type actually used.
+func EncodeImage(w io.Writer, img image.Image, format string) (string, error) {
+	switch format {
+	case "image/png", "png":
+		return "image/png", png.Encode(w, img)
+	default:
+		return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	}
+}
+
+// Thumbnail decodes an image from r and returns a downscaled copy encoded
+// as format, along with its MIME type.
+func Thumbnail(r io.Reader, maxWidth, maxHeight int, format string) ([]byte, string, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, "", err
+	}
+	buf := &bytes.Buffer{}
+	mime, err := EncodeImage(buf, ScaleImage(img, maxWidth, maxHeight), format)
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), mime, nil
+}
+
+// generateThumb derives a thumbnail from the stored cover of book id.
+func (srv *Server) generateThumb(id string, meta *OpdsMeta) error {
+	cover, err := os.Open(filepath.FromSlash(srv.Files + "/covers/" + id))
+	if err != nil {
+		return err
+	}
+	defer cover.Close()
+	thumb, mime, err := Thumbnail(cover, ThumbWidth, ThumbHeight, ThumbFormat)
+	if err != nil {
+		return err
+	}
+	return srv.storeThumb(id, meta, thumb, mime)
+}
+
+// storeThumb writes thumb as the thumbnail of book id and records it in
+// meta.
+func (srv *Server) storeThumb(id string, meta *OpdsMeta, thumb []byte, mime string) error {
+	err := ioutil.WriteFile(filepath.FromSlash(srv.Files+"/thumbs/"+id), thumb, 0666)
+	if err != nil {
+		return err
+	}
+	meta.Thumb = true
+	meta.ThumbType = mime
+	return nil
+}
+
+// ResizedCover returns the path of a copy of book id's cover scaled to fit
+// width x height, creating it in the image cache if necessary.
+func (srv *Server) ResizedCover(id string, width, height int) (string, string, error) {
+	book := &OpdsEntry{}
+	err := srv.DB.Get("books", id, book)
+	if err != nil {
+		return "", "", err
+	}
+	if !book.Cover {
+		return "", "", os.ErrNotExist
+	}
+	format := "image/jpeg"
+	if book.CoverType == "image/png" {
+		format = "image/png"
+	}
+	cacheDir := filepath.FromSlash(srv.Files + "/cache")
+	cached := filepath.Join(cacheDir, fmt.Sprintf("%s-%dx%d", id, width, height))
+	if _, err := os.Stat(cached); err == nil {
+		return cached, format, nil
+	}
+
+	cover, err := os.Open(filepath.FromSlash(srv.Files + "/covers/" + id))
+	if err != nil {
+		return "", "", err
+	}
+	defer cover.Close()
+	img, mime, err := Thumbnail(cover, width, height, format)
+	if err != nil {
+		return "", "", err
+	}
+	err = os.MkdirAll(cacheDir, os.ModeDir|0777)
+	if err != nil {
+		return "", "", err
+	}
+	// Write to a temporary name first so concurrent requests never see a
+	// partial file.
+	tmp := cached + "." + Uuidgen()
+	err = ioutil.WriteFile(tmp, img, 0666)
+	if err != nil {
+		return "", "", err
+	}
+	return cached, mime, os.Rename(tmp, cached)
+}
+
+func (srv *Server) clearImageCache(id string) {
+	cached, _ := filepath.Glob(filepath.FromSlash(srv.Files + "/cache/" + id + "-*"))
+	for _, v := range cached {
+		os.Remove(v)
+	}
+}
+
+func (srv *Server) handleCover(w http.ResponseWriter, r *http.Request) {
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) < 2 || components[1] == "" {
+		http.Error(w, "Must give book uuid", 404)
+		return
+	}
+	id := components[1]
+	width, _ := strconv.Atoi(r.FormValue("width"))
+	height, _ := strconv.Atoi(r.FormValue("height"))
+	if width < 0 || height < 0 || width > maxResize || height > maxResize {
+		http.Error(w, "Bad image size", 400)
+		return
+	}
+	if width == 0 && height == 0 {
+		http.Redirect(w, r, "/get/covers/"+id, 302)
+		return
+	}
+	cached, mime, err := srv.ResizedCover(id, width, height)
+	if err != nil {
+		http.Error(w, "Cover not found", 404)
+		return
+	}
+	w.Header().Set("Content-Type", mime)
+	http.ServeFile(w, r, cached)
+}
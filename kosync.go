@@ -0,0 +1,277 @@
+package gopds
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SyncRegistration lets KOReader create accounts through the kosync API.
+// Accounts made that way get the guest role. Registration stays closed
+// until an admin exists, since the first account would otherwise close
+// an open catalog to everyone else.
+var SyncRegistration bool
+
+// Progress is a reading position as KOReader's kosync protocol reports it.
+type Progress struct {
+	Document   string  `json:"document"`
+	Progress   string  `json:"progress"`
+	Percentage float64 `json:"percentage"`
+	Device     string  `json:"device"`
+	DeviceId   string  `json:"device_id"`
+	Timestamp  int64   `json:"timestamp"`
+}
+
+// partialMD5 is the document hash KOReader uses by default: an MD5 of
+// 1KiB samples taken at offsets 0 and 1024<<2i for i up to 10.
+func partialMD5(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := md5.New()
+	sample := make([]byte, 1024)
+	for i := -1; i <= 10; i++ {
+		offset := int64(0)
+		if i >= 0 {
+			offset = 1024 << uint(2*i)
+		}
+		n, err := file.ReadAt(sample, offset)
+		if n == 0 {
+			if err != nil && err != io.EOF {
+				return "", err
+			}
+			break
+		}
+		hash.Write(sample[:n])
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// syncKey is the bcrypt hash of the key KOReader sends for password, its
+// MD5 in hex.
+func syncKey(password string) ([]byte, error) {
+	sum := md5.Sum([]byte(password))
+	return bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(sum[:])), bcrypt.DefaultCost)
+}
+
+func progressKey(user, document string) string {
+	return user + ":" + document
+}
+
+// GetProgress returns user's last position in the document with the
+// given partial MD5.
+func (srv *Server) GetProgress(user, document string) (*Progress, error) {
+	p := &Progress{}
+	err := srv.DB.Get("progress", progressKey(user, document), p)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetProgress records user's position in a document.
+func (srv *Server) SetProgress(user string, p *Progress) error {
+	return srv.DB.Set("progress", progressKey(user, p.Document), p)
+}
+
+// kosync error codes, as the reference server sends them.
+var syncErrors = map[int]struct {
+	status  int
+	message string
+}{
+	2001: {401, "Unauthorized"},
+	2002: {402, "Username is already registered."},
+	2003: {403, "Invalid request"},
+	2004: {403, "Field 'document' not provided."},
+	2005: {402, "User registration is disabled."},
+}
+
+func syncError(w http.ResponseWriter, code int) {
+	e := syncErrors[code]
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	fmt.Fprintf(w, `{"code":%d,"message":%q}`, code, e.message)
+}
+
+func syncReply(w http.ResponseWriter, status int, v interface{}) {
+	out, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// syncUser checks the x-auth-user and x-auth-key headers KOReader sends
+// with every request.
+func (srv *Server) syncUser(r *http.Request) *User {
+	name, key := r.Header.Get("x-auth-user"), r.Header.Get("x-auth-key")
+	user, err := srv.GetUser(name)
+	if err != nil || key == "" || len(user.SyncKey) == 0 {
+		return nil
+	}
+	// no user name contains ':', so these can't collide with Basic logins
+	cacheName := "kosync:" + name
+	if srv.logins.check(cacheName, key) {
+		return user
+	}
+	if bcrypt.CompareHashAndPassword(user.SyncKey, []byte(key)) != nil {
+		return nil
+	}
+	srv.logins.remember(cacheName, key)
+	return user
+}
+
+// registerSync creates an account from KOReader's registration form,
+// which only ever carries the MD5 of the password. That key is then also
+// the account's password for Basic logins.
+func (srv *Server) registerSync(w http.ResponseWriter, r *http.Request) {
+	if !SyncRegistration {
+		syncError(w, 2005)
+		return
+	}
+	form := &struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(form)
+	if err != nil || form.Username == "" || form.Password == "" || strings.Contains(form.Username, ":") {
+		syncError(w, 2003)
+		return
+	}
+	srv.Mut.Lock()
+	defer srv.Mut.Unlock()
+	if !srv.hasAdmin() {
+		syncError(w, 2005)
+		return
+	}
+	if _, err := srv.GetUser(form.Username); err == nil {
+		syncError(w, 2002)
+		return
+	}
+	user := &User{Name: form.Username, Role: RoleGuest}
+	user.Password, err = bcrypt.GenerateFromPassword([]byte(form.Password), bcrypt.DefaultCost)
+	if err == nil {
+		user.SyncKey = user.Password
+		err = srv.DB.Set("users", user.Name, user)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	syncReply(w, 201, map[string]string{"username": user.Name})
+}
+
+// handleKosync implements KOReader's progress sync API below /kosync/,
+// which is the server address to give KOReader.
+func (srv *Server) handleKosync(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/healthcheck":
+		syncReply(w, 200, map[string]string{"state": "OK"})
+		return
+	case r.URL.Path == "/users/create" && r.Method == "POST":
+		srv.registerSync(w, r)
+		return
+	}
+	user := srv.syncUser(r)
+	if user == nil {
+		syncError(w, 2001)
+		return
+	}
+	switch {
+	case r.URL.Path == "/users/auth" && r.Method == "GET":
+		syncReply(w, 200, map[string]string{"authorized": "OK"})
+	case r.URL.Path == "/syncs/progress" && r.Method == "PUT":
+		p := &Progress{}
+		err := json.NewDecoder(r.Body).Decode(p)
+		if err != nil {
+			syncError(w, 2003)
+			return
+		}
+		if p.Document == "" {
+			syncError(w, 2004)
+			return
+		}
+		p.Timestamp = time.Now().Unix()
+		err = srv.SetProgress(user.Name, p)
+		if err == nil {
+			err = srv.progressStatus(user.Name, p)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		syncReply(w, 200, map[string]interface{}{"document": p.Document, "timestamp": p.Timestamp})
+	case strings.HasPrefix(r.URL.Path, "/syncs/progress/") && r.Method == "GET":
+		document := strings.TrimPrefix(r.URL.Path, "/syncs/progress/")
+		p, err := srv.GetProgress(user.Name, document)
+		if err != nil {
+			// the reference server answers an unknown document with {}
+			syncReply(w, 200, struct{}{})
+			return
+		}
+		syncReply(w, 200, p)
+	default:
+		syncError(w, 2003)
+	}
+}
+
+// setPartialMD5 records the kosync document hash of stored book id and
+// indexes the book by it, so progress reports needn't search every book.
+func (srv *Server) setPartialMD5(id string, meta *OpdsMeta) {
+	sum, err := partialMD5(filepath.FromSlash(srv.Files + "/books/" + id))
+	if err != nil {
+		log.Printf("Error: hashing %s: %s", id, err.Error())
+		return
+	}
+	if meta.PartialMD5 != sum {
+		srv.unindexPartialMD5(meta.PartialMD5, id)
+	}
+	meta.PartialMD5 = sum
+	srv.indexPartialMD5(sum, id)
+}
+
+func (srv *Server) indexPartialMD5(sum, id string) {
+	err := srv.DB.Set("partialmd5", sum, id)
+	if err != nil {
+		log.Printf("Error: indexing %s: %s", id, err.Error())
+	}
+}
+
+// unindexPartialMD5 drops sum from the index unless another copy of the
+// same file has taken it over.
+func (srv *Server) unindexPartialMD5(sum, id string) {
+	indexed := ""
+	if sum != "" && srv.DB.Get("partialmd5", sum, &indexed) == nil && indexed == id {
+		srv.DB.Del("partialmd5", sum)
+	}
+}
+
+// bookByPartialMD5 finds the book with the kosync document hash sum, or
+// returns nil if there is none.
+func (srv *Server) bookByPartialMD5(sum string) (*OpdsEntry, error) {
+	ok, err := srv.DB.Exists("partialmd5", sum)
+	if err != nil || !ok {
+		return nil, err
+	}
+	id := ""
+	err = srv.DB.Get("partialmd5", sum, &id)
+	if err != nil {
+		return nil, err
+	}
+	book := &OpdsEntry{}
+	if srv.DB.Get("books", id, book) != nil || book.PartialMD5 != sum {
+		return nil, nil
+	}
+	return book, nil
+}
@@ -0,0 +1,79 @@
+package gopds
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPartialMD5(t *testing.T) {
+	// expected sums computed with KOReader's own sampling
+	tests := []struct {
+		size int
+		want string
+	}{
+		{0, "d41d8cd98f00b204e9800998ecf8427e"},
+		{100, "85ea49bad31515e9059bda672b58c001"},
+		{1024, "9b39cd2b118cba2e82859a59859618c2"},
+		{1500, "2f69e44c5857609d5a47c8d278ac5bc6"},
+		{5000, "21fe596538939a36183a2f637768682c"},
+		{70000, "5665fa6ed861428352f7dc6a4a869729"},
+		{3 << 20, "81a460d994652927f0a27f19ef681fe0"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		data := make([]byte, tt.size)
+		for i := range data {
+			data[i] = byte(i * 7 % 251)
+		}
+		path := filepath.Join(dir, "book")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := partialMD5(path)
+		if err != nil || got != tt.want {
+			t.Errorf("partialMD5 of %d bytes = %s, %v, want %s", tt.size, got, err, tt.want)
+		}
+	}
+	if _, err := partialMD5(filepath.Join(dir, "missing")); err == nil {
+		t.Error("hashed a missing file")
+	}
+}
+
+func TestRegisterSync(t *testing.T) {
+	srv := newTestServer(t)
+	defer func(v bool) { SyncRegistration = v }(SyncRegistration)
+	register := func(name string) (int, string) {
+		body := strings.NewReader(`{"username":"` + name + `","password":"5f4dcc3b5aa765d61d8327deb882cf99"}`)
+		r := httptest.NewRequest("POST", "/users/create", body)
+		w := httptest.NewRecorder()
+		srv.handleKosync(w, r)
+		return w.Code, w.Body.String()
+	}
+	tests := []struct {
+		name, user string
+		setup      func()
+		status     int
+		code       string
+	}{
+		{"disabled", "kobo", func() { SyncRegistration = false }, 402, `"code":2005`},
+		{"no users", "kobo", func() { SyncRegistration = true }, 402, `"code":2005`},
+		{"no admin", "kobo", func() { srv.SetUser("reader", "pw", RoleReader, nil) }, 402, `"code":2005`},
+		{"admin", "kobo", func() { srv.SetUser("root", "pw", RoleAdmin, nil) }, 201, `"username":"kobo"`},
+		{"taken", "kobo", func() {}, 402, `"code":2002`},
+		{"bad name", "a:b", func() {}, 403, `"code":2003`},
+	}
+	for _, tt := range tests {
+		tt.setup()
+		status, body := register(tt.user)
+		if status != tt.status || !strings.Contains(body, tt.code) {
+			t.Errorf("%s: %d %s, want %d %s", tt.name, status, body, tt.status, tt.code)
+		}
+	}
+	user, err := srv.GetUser("kobo")
+	if err != nil || user.role() != RoleGuest {
+		t.Errorf("registered user %+v, %v", user, err)
+	}
+}
@@ -0,0 +1,148 @@
+package gopds
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MetaWriter copies the book at path to out with its embedded metadata
+// replaced by meta. cover holds the new cover image, of type
+// meta.CoverType, when the cover was replaced and is nil otherwise.
+type MetaWriter func(path string, out io.Writer, meta *OpdsMeta, cover []byte) error
+
+// WriteBack makes metadata edits rewrite the stored book files of types
+// with a registered MetaWriter, so downloads carry the corrected metadata.
+var WriteBack bool = false
+
+// MetadataWriter registers the writer used to update books of bookType.
+func (srv *Server) MetadataWriter(bookType string, write MetaWriter) {
+	srv.writers[bookType] = write
+}
+
+// UpdateBook replaces the stored metadata of book id.
+func (srv *Server) UpdateBook(id string, meta *OpdsMeta) error {
+	srv.Mut.Lock()
+	defer srv.Mut.Unlock()
+	exists, err := srv.DB.Exists("books", id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return os.ErrNotExist
+	}
+	return srv.writeBack(id, meta, nil)
+}
+
+// SetCover replaces the cover of book id with the image read from r and
+// regenerates its thumbnail.
+func (srv *Server) SetCover(id string, r io.Reader) error {
+	srv.Mut.Lock()
+	defer srv.Mut.Unlock()
+	book := &OpdsEntry{}
+	err := srv.DB.Get("books", id, book)
+	if err != nil {
+		return err
+	}
+	cover, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	coverType := http.DetectContentType(cover)
+	if !strings.HasPrefix(coverType, "image/") {
+		return errors.New("Cover is not an image: " + coverType)
+	}
+	// decode before touching the stored cover, so an image we can't read
+	// leaves the book as it was
+	thumb, thumbType, err := Thumbnail(bytes.NewReader(cover), ThumbWidth, ThumbHeight, ThumbFormat)
+	if err != nil {
+		return errors.New("Can't read cover: " + err.Error())
+	}
+	err = ioutil.WriteFile(filepath.FromSlash(srv.Files+"/covers/"+id), cover, 0666)
+	if err != nil {
+		return err
+	}
+	meta := book.OpdsMeta
+	meta.Cover = true
+	meta.CoverType = coverType
+	srv.clearImageCache(id)
+	err = srv.storeThumb(id, meta, thumb, thumbType)
+	if err != nil {
+		return err
+	}
+	return srv.writeBack(id, meta, cover)
+}
+
+// writeBack stores meta and, when enabled, rewrites the book file to
+// match it. Must be called with srv.Mut held.
+func (srv *Server) writeBack(id string, meta *OpdsMeta, cover []byte) error {
+	bookType := meta.bookType()
+	write := srv.writers[bookType]
+	// conversions may carry the old metadata
+	srv.clearConversions(id)
+	if !WriteBack || write == nil {
+		return srv.updateBookDB(id, meta)
+	}
+	bookPath := filepath.FromSlash(srv.Files + "/books/" + id)
+	tmp := filepath.FromSlash(srv.Files + "/tmp/" + id + "." + Uuidgen())
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	err = write(bookPath, io.MultiWriter(file, hash), meta, cover)
+	file.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	err = os.Rename(tmp, bookPath)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	srv.pages.drop(id)
+	srv.clearConversions(id)
+	meta.Hash = hex.EncodeToString(hash.Sum(nil))
+	srv.setPartialMD5(id, meta)
+	return srv.updateBookDB(id, meta)
+}
+
+// copyHashed writes r to path, returning the hex SHA-256 of the contents.
+func copyHashed(path string, r io.Reader) (string, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), r)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// editableMeta applies a JSON metadata edit on top of meta, keeping the
+// fields that describe the stored files rather than the book.
+func editableMeta(meta *OpdsMeta, edit []byte) (*OpdsMeta, error) {
+	out := *meta
+	err := json.Unmarshal(edit, &out)
+	if err != nil {
+		return nil, err
+	}
+	out.BookType = meta.BookType
+	out.Cover, out.CoverType = meta.Cover, meta.CoverType
+	out.Thumb, out.ThumbType = meta.Thumb, meta.ThumbType
+	out.Hash, out.PartialMD5 = meta.Hash, meta.PartialMD5
+	out.LegacyAuthor = nil
+	return &out, nil
+}
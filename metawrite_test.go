@@ -0,0 +1,55 @@
+package gopds
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetCover(t *testing.T) {
+	srv := newTestServer(t)
+	storeTestBook(t, srv, "book", "book data")
+	cover := &bytes.Buffer{}
+	if err := png.Encode(cover, image.NewGray(image.Rect(0, 0, 40, 60))); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.SetCover("book", bytes.NewReader(cover.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	check := func(when string) {
+		book := &OpdsEntry{}
+		if err := srv.DB.Get("books", "book", book); err != nil {
+			t.Fatal(err)
+		}
+		if !book.Cover || book.CoverType != "image/png" || !book.Thumb {
+			t.Errorf("%s: cover %v %s, thumb %v", when, book.Cover, book.CoverType, book.Thumb)
+		}
+		stored, err := os.ReadFile(filepath.Join(srv.Files, "covers", "book"))
+		if err != nil || !bytes.Equal(stored, cover.Bytes()) {
+			t.Errorf("%s: stored cover changed, %v", when, err)
+		}
+		if _, err := os.Stat(filepath.Join(srv.Files, "thumbs", "book")); err != nil {
+			t.Errorf("%s: %s", when, err)
+		}
+	}
+	check("png")
+
+	// an image type we can't decode leaves the old cover in place
+	webp := []byte("RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00")
+	err := srv.SetCover("book", bytes.NewReader(webp))
+	if err == nil || !strings.Contains(err.Error(), "Can't read cover") {
+		t.Errorf("webp cover: %v", err)
+	}
+	check("webp")
+
+	if err = srv.SetCover("book", strings.NewReader("plain text")); err == nil {
+		t.Error("accepted a text cover")
+	}
+	if err = srv.SetCover("missing", bytes.NewReader(cover.Bytes())); err == nil {
+		t.Error("set the cover of a missing book")
+	}
+}
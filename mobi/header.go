@@ -0,0 +1,161 @@
+package mobi
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	palmHeaderLen = 78
+	recordInfoLen = 8
+
+	encodingCP1252 = 1252
+	encodingUTF8   = 65001
+
+	noImage = 0xFFFFFFFF
+)
+
+// EXTH record types.
+const (
+	ExthAuthor      = 100
+	ExthPublisher   = 101
+	ExthDescription = 103
+	ExthISBN        = 104
+	ExthSubject     = 105
+	ExthPubDate     = 106
+	ExthRights      = 109
+	ExthASIN        = 113
+	ExthCoverOffset = 201
+	ExthThumbOffset = 202
+	ExthTitle       = 503
+	ExthLanguage    = 524
+)
+
+type PalmDB struct {
+	Name      string
+	Type      string
+	Creator   string
+	Offsets   []uint32
+	totalSize int64
+}
+
+type MobiHeader struct {
+	Compression     uint16
+	MobiType        uint32
+	TextEncoding    uint32
+	FileVersion     uint32
+	FullName        string
+	Locale          uint32
+	FirstImageIndex uint32
+	ExthFlags       uint32
+	Exth            map[uint32][][]byte
+}
+
+var be = binary.BigEndian
+
+func readPalmDB(r io.ReaderAt, size int64) (*PalmDB, error) {
+	head := make([]byte, palmHeaderLen)
+	_, err := r.ReadAt(head, 0)
+	if err != nil {
+		return nil, err
+	}
+	db := &PalmDB{Name: cString(head[0:32]),
+		Type:      string(head[60:64]),
+		Creator:   string(head[64:68]),
+		totalSize: size}
+	numRecords := int(be.Uint16(head[76:78]))
+	if numRecords == 0 {
+		return nil, errors.New("No records in PalmDB")
+	}
+	info := make([]byte, numRecords*recordInfoLen)
+	_, err = r.ReadAt(info, palmHeaderLen)
+	if err != nil {
+		return nil, err
+	}
+	db.Offsets = make([]uint32, numRecords)
+	for i := range db.Offsets {
+		db.Offsets[i] = be.Uint32(info[i*recordInfoLen:])
+	}
+	return db, nil
+}
+
+// record reads the n'th record, which runs up to the start of the next one.
+func (db *PalmDB) record(r io.ReaderAt, n int) ([]byte, error) {
+	if n < 0 || n >= len(db.Offsets) {
+		return nil, errors.New("Record out of range")
+	}
+	start := int64(db.Offsets[n])
+	end := db.totalSize
+	if n+1 < len(db.Offsets) {
+		end = int64(db.Offsets[n+1])
+	}
+	if end < start || end > db.totalSize {
+		return nil, errors.New("Corrupt record table")
+	}
+	buf := make([]byte, end-start)
+	_, err := r.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func readMobiHeader(rec0 []byte) (*MobiHeader, error) {
+	if len(rec0) < 132 || string(rec0[16:20]) != "MOBI" {
+		return nil, errors.New("Missing MOBI header")
+	}
+	hdr := &MobiHeader{Compression: be.Uint16(rec0[0:2]),
+		MobiType:        be.Uint32(rec0[24:28]),
+		TextEncoding:    be.Uint32(rec0[28:32]),
+		FileVersion:     be.Uint32(rec0[36:40]),
+		Locale:          be.Uint32(rec0[92:96]),
+		FirstImageIndex: be.Uint32(rec0[108:112]),
+		ExthFlags:       be.Uint32(rec0[128:132]),
+		Exth:            make(map[uint32][][]byte)}
+	headerLen := be.Uint32(rec0[20:24])
+
+	nameOffset := be.Uint32(rec0[84:88])
+	nameLen := be.Uint32(rec0[88:92])
+	if uint64(nameOffset)+uint64(nameLen) <= uint64(len(rec0)) {
+		hdr.FullName = string(rec0[nameOffset : nameOffset+nameLen])
+	}
+
+	if hdr.ExthFlags&0x40 != 0 {
+		err := hdr.readExth(rec0, 16+int(headerLen))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hdr, nil
+}
+
+func (hdr *MobiHeader) readExth(rec0 []byte, pos int) error {
+	if pos+12 > len(rec0) || string(rec0[pos:pos+4]) != "EXTH" {
+		return errors.New("Missing EXTH header")
+	}
+	count := int(be.Uint32(rec0[pos+8 : pos+12]))
+	pos += 12
+	for i := 0; i < count; i++ {
+		if pos+8 > len(rec0) {
+			return errors.New("Truncated EXTH header")
+		}
+		typ := be.Uint32(rec0[pos : pos+4])
+		length := int(be.Uint32(rec0[pos+4 : pos+8]))
+		if length < 8 || pos+length > len(rec0) {
+			return errors.New("Corrupt EXTH record")
+		}
+		hdr.Exth[typ] = append(hdr.Exth[typ], rec0[pos+8:pos+length])
+		pos += length
+	}
+	return nil
+}
+
+func cString(b []byte) string {
+	for i, v := range b {
+		if v == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,194 @@
+package mobi
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Pursuit92/gopds"
+)
+
+const (
+	MobiType = "application/x-mobipocket-ebook"
+	Azw3Type = "application/vnd.amazon.ebook"
+)
+
+// Windows primary language ids used in the MOBI locale field, for books
+// without an EXTH language record.
+var locales = map[uint32]string{
+	4:  "zh",
+	7:  "de",
+	9:  "en",
+	10: "es",
+	12: "fr",
+	16: "it",
+	17: "ja",
+	19: "nl",
+	21: "pl",
+	22: "pt",
+	25: "ru",
+	29: "sv",
+}
+
+type Mobi struct {
+	path     string
+	bookType string
+	*PalmDB
+	*MobiHeader
+	cover     []byte
+	coverType string
+}
+
+func ReadMobi(path string) (gopds.Ebook, error) {
+	return readMobi(path, MobiType)
+}
+
+func ReadAzw3(path string) (gopds.Ebook, error) {
+	return readMobi(path, Azw3Type)
+}
+
+func readMobi(path, bookType string) (*Mobi, error) {
+	safePath := filepath.FromSlash(path)
+	file, err := os.Open(safePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	book := &Mobi{path: safePath, bookType: bookType}
+	book.PalmDB, err = readPalmDB(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	if book.Type != "BOOK" || book.Creator != "MOBI" {
+		return nil, errors.New("Not a MOBI file: " + path)
+	}
+	rec0, err := book.record(file, 0)
+	if err != nil {
+		return nil, err
+	}
+	book.MobiHeader, err = readMobiHeader(rec0)
+	if err != nil {
+		return nil, err
+	}
+
+	book.cover = book.image(file, ExthCoverOffset)
+	if book.cover != nil {
+		book.coverType = http.DetectContentType(book.cover)
+	}
+	return book, nil
+}
+
+// image loads the image record referenced by the given EXTH offset record.
+func (book *Mobi) image(r io.ReaderAt, exthType uint32) []byte {
+	if book.FirstImageIndex == noImage {
+		return nil
+	}
+	offset, ok := book.exthInt(exthType)
+	if !ok || offset == noImage {
+		return nil
+	}
+	img, err := book.record(r, int(book.FirstImageIndex+offset))
+	if err != nil || !strings.HasPrefix(http.DetectContentType(img), "image/") {
+		return nil
+	}
+	return img
+}
+
+func (book *Mobi) exthInt(typ uint32) (uint32, bool) {
+	vals := book.Exth[typ]
+	if len(vals) == 0 || len(vals[0]) != 4 {
+		return 0, false
+	}
+	return be.Uint32(vals[0]), true
+}
+
+func (book *Mobi) decode(b []byte) string {
+	if book.TextEncoding == encodingCP1252 {
+		return strings.TrimSpace(gopds.DecodeString("windows-1252", string(b)))
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func (book *Mobi) exthString(typ uint32) string {
+	vals := book.Exth[typ]
+	if len(vals) == 0 {
+		return ""
+	}
+	return book.decode(vals[0])
+}
+
+func (book *Mobi) exthStrings(typ uint32) []string {
+	out := []string{}
+	for _, v := range book.Exth[typ] {
+		if s := book.decode(v); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (book Mobi) Cover() io.ReadCloser {
+	return ioutil.NopCloser(bytes.NewReader(book.cover))
+}
+
+// Thumb returns nil: the server makes thumbnails from the cover.
+func (book Mobi) Thumb() io.ReadCloser {
+	return nil
+}
+
+func (book Mobi) Book() io.ReadCloser {
+	file, _ := os.Open(book.path)
+	return file
+}
+
+func (book Mobi) OpdsMeta() *gopds.OpdsMeta {
+	meta := &gopds.OpdsMeta{Title: book.exthString(ExthTitle),
+		Publisher: book.exthString(ExthPublisher),
+		Issued:    book.exthString(ExthPubDate),
+		Lang:      book.exthString(ExthLanguage),
+		Summary:   book.exthString(ExthDescription),
+		Rights:    book.exthString(ExthRights),
+		Subjects:  book.exthStrings(ExthSubject),
+		Category:  strings.Join(book.exthStrings(ExthSubject), ", "),
+		BookType:  book.bookType,
+		Cover:     book.cover != nil,
+		CoverType: book.coverType}
+	if meta.Title == "" {
+		meta.Title = book.decode([]byte(book.FullName))
+	}
+	if meta.Title == "" {
+		meta.Title = strings.Replace(book.Name, "_", " ", -1)
+	}
+	if meta.Lang == "" {
+		meta.Lang = locales[book.Locale&0xFF]
+	}
+	for _, v := range book.exthStrings(ExthAuthor) {
+		meta.Authors = append(meta.Authors, &gopds.OpdsAuthor{Name: v})
+	}
+	if isbn := book.ISBN(); isbn != "" {
+		meta.Identifiers = append(meta.Identifiers, &gopds.OpdsIdentifier{Scheme: "ISBN", Value: isbn})
+	}
+	if asin := book.exthString(ExthASIN); asin != "" {
+		meta.Identifiers = append(meta.Identifiers, &gopds.OpdsIdentifier{Scheme: "ASIN", Value: asin})
+	}
+	return meta
+}
+
+// ISBN returns the ISBN recorded in the EXTH header, if any.
+func (book Mobi) ISBN() string {
+	return book.exthString(ExthISBN)
+}
+
+func (book *Mobi) Close() {
+	os.Remove(book.path)
+}
@@ -0,0 +1,195 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type exthRecord struct {
+	typ  uint32
+	data []byte
+}
+
+func exthInt(typ, v uint32) exthRecord {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return exthRecord{typ, b}
+}
+
+// testRecord0 builds a PalmDOC header, a MOBI header of the minimum
+// length and an EXTH header holding exth, followed by the full name.
+func testRecord0(encoding, locale uint32, name string, exth []exthRecord) []byte {
+	const headerLen = 116
+	rec := make([]byte, 16+headerLen)
+	be.PutUint16(rec[0:2], 2)
+	copy(rec[16:20], "MOBI")
+	be.PutUint32(rec[20:24], headerLen)
+	be.PutUint32(rec[24:28], 2)
+	be.PutUint32(rec[28:32], encoding)
+	be.PutUint32(rec[36:40], 6)
+	be.PutUint32(rec[92:96], locale)
+	be.PutUint32(rec[108:112], 1)
+	if exth != nil {
+		be.PutUint32(rec[128:132], 0x40)
+		body := &bytes.Buffer{}
+		for _, v := range exth {
+			binary.Write(body, be, v.typ)
+			binary.Write(body, be, uint32(8+len(v.data)))
+			body.Write(v.data)
+		}
+		head := make([]byte, 12)
+		copy(head, "EXTH")
+		be.PutUint32(head[4:8], uint32(12+body.Len()))
+		be.PutUint32(head[8:12], uint32(len(exth)))
+		rec = append(append(rec, head...), body.Bytes()...)
+	}
+	be.PutUint32(rec[84:88], uint32(len(rec)))
+	be.PutUint32(rec[88:92], uint32(len(name)))
+	return append(rec, name...)
+}
+
+// testPalmDB lays records out after a PalmDB header.
+func testPalmDB(name string, records ...[]byte) []byte {
+	head := make([]byte, palmHeaderLen+len(records)*recordInfoLen)
+	copy(head, name)
+	copy(head[60:64], "BOOK")
+	copy(head[64:68], "MOBI")
+	be.PutUint16(head[76:78], uint16(len(records)))
+	out := &bytes.Buffer{}
+	offset := len(head)
+	for i, v := range records {
+		be.PutUint32(head[palmHeaderLen+i*recordInfoLen:], uint32(offset))
+		offset += len(v)
+	}
+	out.Write(head)
+	for _, v := range records {
+		out.Write(v)
+	}
+	return out.Bytes()
+}
+
+var testPNG = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+
+func TestReadMobi(t *testing.T) {
+	tests := []struct {
+		name      string
+		rec0      []byte
+		title     string
+		lang      string
+		authors   []string
+		subjects  []string
+		isbn      string
+		hasCover  bool
+		coverType string
+	}{
+		{"utf-8 exth",
+			testRecord0(encodingUTF8, 9, "Full Name", []exthRecord{
+				{ExthTitle, []byte("Café Title")},
+				{ExthAuthor, []byte("Ann Author")},
+				{ExthAuthor, []byte("Bob Writer")},
+				{ExthSubject, []byte("Fiction")},
+				{ExthISBN, []byte("9780000000002")},
+				exthInt(ExthCoverOffset, 0)}),
+			"Café Title", "en", []string{"Ann Author", "Bob Writer"}, []string{"Fiction"},
+			"9780000000002", true, "image/png"},
+		{"cp1252 exth",
+			testRecord0(encodingCP1252, 12, "Full Name", []exthRecord{
+				{ExthTitle, []byte("Caf\xe9 \x93Quoted\x94")},
+				{ExthLanguage, []byte("fr-FR")}}),
+			"Café “Quoted”", "fr-FR", nil, []string{}, "", false, ""},
+		{"full name, locale",
+			testRecord0(encodingUTF8, 0x0419, "Full Name", nil),
+			"Full Name", "ru", nil, []string{}, "", false, ""},
+		{"palm name",
+			testRecord0(encodingUTF8, 0, "", nil),
+			"Palm Name", "", nil, []string{}, "", false, ""},
+		{"no image",
+			testRecord0(encodingUTF8, 0, "T", []exthRecord{exthInt(ExthCoverOffset, noImage)}),
+			"T", "", nil, []string{}, "", false, ""},
+	}
+	dir := t.TempDir()
+	for i, tt := range tests {
+		path := filepath.Join(dir, tt.name+".mobi")
+		err := os.WriteFile(path, testPalmDB("Palm_Name", tt.rec0, testPNG), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		book, err := readMobi(path, MobiType)
+		if err != nil {
+			t.Errorf("%d %s: %s", i, tt.name, err)
+			continue
+		}
+		meta := book.OpdsMeta()
+		if meta.Title != tt.title || meta.Lang != tt.lang {
+			t.Errorf("%s: title %q lang %q, want %q %q", tt.name, meta.Title, meta.Lang, tt.title, tt.lang)
+		}
+		authors := []string(nil)
+		for _, v := range meta.Authors {
+			authors = append(authors, v.Name)
+		}
+		if !reflect.DeepEqual(authors, tt.authors) || !reflect.DeepEqual(meta.Subjects, tt.subjects) {
+			t.Errorf("%s: authors %v subjects %v, want %v %v", tt.name, authors, meta.Subjects, tt.authors, tt.subjects)
+		}
+		if book.ISBN() != tt.isbn {
+			t.Errorf("%s: isbn %q, want %q", tt.name, book.ISBN(), tt.isbn)
+		}
+		if meta.Cover != tt.hasCover || meta.CoverType != tt.coverType {
+			t.Errorf("%s: cover %v %q, want %v %q", tt.name, meta.Cover, meta.CoverType, tt.hasCover, tt.coverType)
+		}
+	}
+}
+
+func TestReadMobiHeaderErrors(t *testing.T) {
+	good := testRecord0(encodingUTF8, 0, "T", []exthRecord{{ExthTitle, []byte("T")}})
+	notMobi := append([]byte{}, good...)
+	copy(notMobi[16:20], "XXXX")
+	truncated := good[:len(good)-6]
+	corrupt := append([]byte{}, good...)
+	// the first EXTH record claims to run past the end of the record
+	be.PutUint32(corrupt[132+12+4:], 4096)
+	tests := []struct {
+		name string
+		rec0 []byte
+	}{
+		{"short", good[:100]},
+		{"not mobi", notMobi},
+		{"truncated exth", truncated},
+		{"corrupt exth", corrupt},
+	}
+	for _, tt := range tests {
+		if _, err := readMobiHeader(tt.rec0); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+	if _, err := readMobiHeader(good); err != nil {
+		t.Errorf("good header: %s", err)
+	}
+}
+
+func TestPalmDBRecords(t *testing.T) {
+	data := testPalmDB("db", []byte("zero"), []byte("one!"), []byte("two"))
+	db, err := readPalmDB(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Name != "db" || db.Type != "BOOK" || db.Creator != "MOBI" || len(db.Offsets) != 3 {
+		t.Fatalf("header %+v", db)
+	}
+	for i, want := range []string{"zero", "one!", "two"} {
+		rec, err := db.record(bytes.NewReader(data), i)
+		if err != nil || string(rec) != want {
+			t.Errorf("record %d = %q, %v, want %q", i, rec, err, want)
+		}
+	}
+	if _, err := db.record(bytes.NewReader(data), 3); err == nil {
+		t.Error("read a record past the end")
+	}
+	db.Offsets[1] = uint32(len(data) + 10)
+	if _, err := db.record(bytes.NewReader(data), 0); err == nil {
+		t.Error("read a record ending past the file")
+	}
+}
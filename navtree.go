@@ -0,0 +1,135 @@
+package gopds
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Deepest chain of parents followed when building breadcrumbs.
+const maxFeedDepth = 16
+
+// feedParent is the name of the feed the named feed sits under. Feeds
+// without a stored parent belong to the root.
+func feedParent(name string, feed *OpdsFeedDB) string {
+	switch {
+	case name == "root":
+		return ""
+	case strings.HasPrefix(name, "author:"):
+		return AuthorsFeed.Name
+	case strings.HasPrefix(name, "my:"), strings.HasPrefix(name, "shelf:"):
+		return ShelvesFeed.Name
+	case feed.Parent != "":
+		return feed.Parent
+	}
+	return "root"
+}
+
+// feedCrumbs links the ancestors of a feed from the root down to parent,
+// passing over the ones acc hides.
+func (srv *Server) feedCrumbs(parent string, acc *access) []*OpdsLink {
+	crumbs := []*OpdsLink{}
+	seen := make(map[string]bool)
+	for parent != "" && !seen[parent] && len(seen) < maxFeedDepth {
+		seen[parent] = true
+		feed := &OpdsFeedDB{}
+		err := srv.DB.Get("nav", parent, feed)
+		if err != nil || acc.hiddenFeeds[parent] {
+			if parent == "root" {
+				break
+			}
+			parent = "root"
+			continue
+		}
+		crumbs = append([]*OpdsLink{&OpdsLink{Href: "/catalog/" + parent,
+			Type:  kindType(feed.Type),
+			Title: feed.Title}}, crumbs...)
+		parent = feedParent(parent, feed)
+	}
+	return crumbs
+}
+
+// adoptFeeds makes parent the parent of the feeds it lists that have
+// none yet.
+func (srv *Server) adoptFeeds(parent string, children []string) error {
+	for _, v := range children {
+		child := &OpdsFeedDB{}
+		if srv.DB.Get("nav", v, child) != nil || child.Parent != "" || v == "root" || v == parent {
+			continue
+		}
+		child.Parent = parent
+		err := srv.setFeed(v, child)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orphanFeeds moves the children of a deleted feed back to the root, and
+// drops the feed from the navigation feeds that list it.
+func (srv *Server) orphanFeeds(parent string) error {
+	iter, err := srv.DB.NewIterator("nav")
+	if err != nil {
+		return err
+	}
+	changed := make(map[string]*OpdsFeedDB)
+	for iter.Next() {
+		feed := &OpdsFeedDB{}
+		if json.Unmarshal(iter.Value(), feed) != nil {
+			continue
+		}
+		name := string(iter.Key())
+		if feed.Parent == parent {
+			feed.Parent = ""
+			changed[name] = feed
+		}
+		// a navigation feed without entries lists every feed, so one
+		// whose only entry is gone keeps it and getNavEntries skips it
+		if feed.Type == Nav && containsString(feed.Entries, parent) && len(feed.Entries) > 1 {
+			entries := []string{}
+			for _, v := range feed.Entries {
+				if v != parent {
+					entries = append(entries, v)
+				}
+			}
+			feed.Entries = entries
+			changed[name] = feed
+		}
+	}
+	iter.Release()
+	for name, feed := range changed {
+		err = srv.setFeed(name, feed)
+		if err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// upgradeFeeds gives feeds without a parent the first navigation feed
+// that lists them, walking down from the root. That covers feeds stored
+// before parents were tracked as well as ones created before the feed
+// listing them.
+func (srv *Server) upgradeFeeds() error {
+	queue := []string{"root"}
+	seen := map[string]bool{"root": true}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		feed := &OpdsFeedDB{}
+		if srv.DB.Get("nav", name, feed) != nil || feed.Type != Nav {
+			continue
+		}
+		err := srv.adoptFeeds(name, feed.Entries)
+		if err != nil {
+			return err
+		}
+		for _, v := range feed.Entries {
+			if !seen[v] {
+				seen[v] = true
+				queue = append(queue, v)
+			}
+		}
+	}
+	return nil
+}
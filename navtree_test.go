@@ -0,0 +1,67 @@
+package gopds
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveAPI sends a request to the /api routes as the named user, with
+// password "pw", or anonymously if user is empty.
+func serveAPI(srv *Server, method, path, body, user string) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, "/api"+path, r)
+	if user != "" {
+		req.SetBasicAuth(user, "pw")
+	}
+	w := httptest.NewRecorder()
+	stripPrefix("/api", srv.authorize(srv.handleAPI))(w, req)
+	return w
+}
+
+func TestDeleteListedFeed(t *testing.T) {
+	srv := newTestServer(t)
+	if err := srv.SetUser("root", "pw", RoleAdmin, nil); err != nil {
+		t.Fatal(err)
+	}
+	only := testFeed(Nav, "all")
+	if err := srv.setFeed("only", only); err != nil {
+		t.Fatal(err)
+	}
+	if w := serveAPI(srv, "DELETE", "/feed/all", "", "root"); w.Code != 200 {
+		t.Fatalf("DELETE /feed/all: %d %s", w.Code, w.Body)
+	}
+
+	root := &OpdsFeedDB{}
+	srv.DB.Get("nav", "root", root)
+	if containsString(root.Entries, "all") || len(root.Entries) != len(RootFeed.Entries)-1 {
+		t.Errorf("root still lists %v", root.Entries)
+	}
+	for _, name := range []string{"root", "only"} {
+		feed, err := srv.getFeedDB(&FeedRequest{Name: name})
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		for _, v := range feed.Entries {
+			if v.Category == "all" {
+				t.Errorf("%s lists the deleted feed", name)
+			}
+		}
+	}
+}
+
+func TestNavEntriesSkipMissing(t *testing.T) {
+	srv := newTestServer(t)
+	entries, err := srv.getNavEntries([]string{"gone", "all", "missing", "recent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Category != "all" || entries[1].Category != "recent" {
+		t.Errorf("entries %+v", entries)
+	}
+}
@@ -0,0 +1,168 @@
+package gopds
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	PseNs     = "http://vaemendis.net/opds-pse/ns"
+	PseStream = "http://vaemendis.net/opds-pse/stream"
+
+	// Number of stored books kept open for page streaming.
+	pagerCacheSize = 4
+)
+
+// Pager gives random access to the page images of a stored book.
+type Pager interface {
+	PageCount() int
+	// Page returns the n'th page (counting from 0) and its MIME type.
+	Page(n int) (io.ReadCloser, string, error)
+	Close()
+}
+
+// PageSource registers open as the Pager for stored books of bookType.
+// Entries of that type are advertised with an OPDS-PSE stream link.
+func (srv *Server) PageSource(bookType string, open func(string) (Pager, error)) {
+	srv.pagers[bookType] = open
+}
+
+func (srv *Server) createStreamLink(entry *OpdsEntry) {
+	if _, ok := srv.pagers[entry.BookType]; !ok || entry.Pages == 0 {
+		return
+	}
+	id := strings.TrimPrefix(entry.Id, "urn:uuid:")
+	entry.Links = append(entry.Links, &OpdsLink{Rel: PseStream,
+		Type:  "image/jpeg",
+		Href:  "/pse/" + id + "/{pageNumber}?width={maxWidth}",
+		Count: entry.Pages})
+}
+
+type pagerCache struct {
+	sync.Mutex
+	ids    []string
+	pagers map[string]Pager
+}
+
+// get must be called with the cache locked.
+func (c *pagerCache) get(id string, open func() (Pager, error)) (Pager, error) {
+	if c.pagers == nil {
+		c.pagers = make(map[string]Pager)
+	}
+	for i, v := range c.ids {
+		if v == id {
+			c.ids = append(append([]string{id}, c.ids[:i]...), c.ids[i+1:]...)
+			return c.pagers[id], nil
+		}
+	}
+	pager, err := open()
+	if err != nil {
+		return nil, err
+	}
+	c.ids = append([]string{id}, c.ids...)
+	c.pagers[id] = pager
+	if len(c.ids) > pagerCacheSize {
+		old := c.ids[len(c.ids)-1]
+		c.ids = c.ids[:len(c.ids)-1]
+		c.pagers[old].Close()
+		delete(c.pagers, old)
+	}
+	return pager, nil
+}
+
+// read returns page n of the book id, opening it with open when it isn't
+// cached. Pagers are shared between requests, so the cache stays locked
+// while the page is read, but callers decode and resize it afterwards.
+func (c *pagerCache) read(id string, n int, open func() (Pager, error)) ([]byte, string, error) {
+	c.Lock()
+	defer c.Unlock()
+	pager, err := c.get(id, open)
+	if err != nil {
+		return nil, "", err
+	}
+	if n < 0 || n >= pager.PageCount() {
+		return nil, "", fmt.Errorf("Page %d out of range", n)
+	}
+	rc, mime, err := pager.Page(n)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rc.Close()
+	buf := &bytes.Buffer{}
+	_, err = io.Copy(buf, rc)
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), mime, nil
+}
+
+func (c *pagerCache) drop(id string) {
+	c.Lock()
+	defer c.Unlock()
+	for i, v := range c.ids {
+		if v == id {
+			c.ids = append(c.ids[:i], c.ids[i+1:]...)
+			c.pagers[id].Close()
+			delete(c.pagers, id)
+			return
+		}
+	}
+}
+
+// GetPage returns page n of the stored book id, downscaled to maxWidth
+// when it is wider than that.
+func (srv *Server) GetPage(id string, n, maxWidth int) ([]byte, string, error) {
+	book := &OpdsEntry{}
+	err := srv.DB.Get("books", id, book)
+	if err != nil {
+		return nil, "", err
+	}
+	open, ok := srv.pagers[book.BookType]
+	if !ok {
+		return nil, "", fmt.Errorf("Can't stream pages of %s", book.BookType)
+	}
+	page, mime, err := srv.pages.read(id, n, func() (Pager, error) {
+		return open(filepath.FromSlash(srv.Files + "/books/" + id))
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if maxWidth <= 0 {
+		return page, mime, nil
+	}
+	conf, _, err := image.DecodeConfig(bytes.NewReader(page))
+	if err != nil || conf.Width <= maxWidth {
+		return page, mime, nil
+	}
+	return Thumbnail(bytes.NewReader(page), maxWidth, 0, mime)
+}
+
+func (srv *Server) handlePage(w http.ResponseWriter, r *http.Request) {
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) < 3 {
+		http.Error(w, "Must give book uuid and page", 404)
+		return
+	}
+	n, err := strconv.Atoi(components[2])
+	if err != nil {
+		http.Error(w, "Bad page number", 400)
+		return
+	}
+	width, _ := strconv.Atoi(r.FormValue("width"))
+	page, mime, err := srv.GetPage(components[1], n, width)
+	if err != nil {
+		log.Print("Error: " + err.Error())
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	w.Header().Set("Content-Type", mime)
+	w.Write(page)
+}
@@ -0,0 +1,116 @@
+package gopds
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// testPager serves the same image for each of its pages.
+type testPager struct {
+	pages  int
+	image  []byte
+	closed bool
+}
+
+func (p *testPager) PageCount() int {
+	return p.pages
+}
+
+func (p *testPager) Page(n int) (io.ReadCloser, string, error) {
+	return ioutil.NopCloser(bytes.NewReader(p.image)), "image/png", nil
+}
+
+func (p *testPager) Close() {
+	p.closed = true
+}
+
+func TestPagerCache(t *testing.T) {
+	c := &pagerCache{}
+	opened := map[string]*testPager{}
+	get := func(id string) {
+		c.Lock()
+		defer c.Unlock()
+		_, err := c.get(id, func() (Pager, error) {
+			p := &testPager{pages: 1}
+			opened[id] = p
+			return p, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, v := range []string{"a", "b", "c", "d", "a", "e"} {
+		get(v)
+	}
+	// a was used again, so b is the least recently used
+	if want := []string{"e", "a", "d", "c"}; !reflect.DeepEqual(c.ids, want) {
+		t.Errorf("cached %v, want %v", c.ids, want)
+	}
+	if len(opened) != 5 || !opened["b"].closed || opened["a"].closed {
+		t.Errorf("opened %d pagers, b closed %v, a closed %v", len(opened), opened["b"].closed, opened["a"].closed)
+	}
+	c.drop("d")
+	c.drop("missing")
+	if !opened["d"].closed || len(c.ids) != 3 || c.pagers["d"] != nil {
+		t.Errorf("dropped d but cached %v", c.ids)
+	}
+
+	c.Lock()
+	_, err := c.get("bad", func() (Pager, error) { return nil, errors.New("unreadable") })
+	c.Unlock()
+	if err == nil || len(c.ids) != 3 {
+		t.Errorf("failed open: %v, cached %v", err, c.ids)
+	}
+}
+
+func TestGetPage(t *testing.T) {
+	srv := newTestServer(t)
+	img := &bytes.Buffer{}
+	if err := png.Encode(img, image.NewGray(image.Rect(0, 0, 200, 100))); err != nil {
+		t.Fatal(err)
+	}
+	opens := 0
+	srv.PageSource("test/pages", func(path string) (Pager, error) {
+		opens++
+		return &testPager{pages: 3, image: img.Bytes()}, nil
+	})
+	srv.updateBookDB("book", &OpdsMeta{Title: "book", BookType: "test/pages", Pages: 3})
+	srv.updateBookDB("text", &OpdsMeta{Title: "text"})
+	tests := []struct {
+		id       string
+		n, width int
+		ok       bool
+		size     int
+	}{
+		{"book", 0, 0, true, 200},
+		{"book", 2, 300, true, 200},
+		{"book", 1, 50, true, 50},
+		{"book", 3, 0, false, 0},
+		{"book", -1, 0, false, 0},
+		{"text", 0, 0, false, 0},
+		{"missing", 0, 0, false, 0},
+	}
+	for _, tt := range tests {
+		page, mime, err := srv.GetPage(tt.id, tt.n, tt.width)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s page %d: %v", tt.id, tt.n, err)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		conf, _, err := image.DecodeConfig(bytes.NewReader(page))
+		if err != nil || mime != "image/png" || conf.Width != tt.size {
+			t.Errorf("%s page %d at %d: %s %d wide, %v, want %d", tt.id, tt.n, tt.width, mime, conf.Width, err, tt.size)
+		}
+	}
+	if opens != 1 {
+		t.Errorf("opened the book %d times", opens)
+	}
+}
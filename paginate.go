@@ -0,0 +1,55 @@
+package gopds
+
+// Number of entries per page of a feed; 0 disables pagination.
+var PageSize int = 50
+
+// FeedRequest describes the part of a feed a client asked for.
+type FeedRequest struct {
+	Name string
+	// Sort method overriding the feed's own, "" for the default
+	Sort string
+	// Page counts from 1; 0 means the first page.
+	Page    int
+	PerPage int
+	// User the feed is filtered for; nil shows everything.
+	User *User
+}
+
+// paginate cuts the sorted entries down to the requested page and links
+// the neighbouring pages.
+func paginate(feed *OpdsFeed, req *FeedRequest) {
+	size := req.PerPage
+	if size <= 0 {
+		return
+	}
+	pages := (len(feed.Entries) + size - 1) / size
+	if pages == 0 {
+		pages = 1
+	}
+	page := req.Page
+	if page < 1 {
+		page = 1
+	} else if page > pages {
+		page = pages
+	}
+	start := (page - 1) * size
+	end := start + size
+	if end > len(feed.Entries) {
+		end = len(feed.Entries)
+	}
+	feed.Entries = feed.Entries[start:end]
+
+	base := feedBase(req)
+	linkType := feedLinkType(feed)
+	addLink := func(rel string, n int) {
+		feed.Links = append(feed.Links, &OpdsLink{Rel: rel, Type: linkType, Href: pageHref(base, n)})
+	}
+	if page > 1 {
+		addLink("first", 1)
+		addLink("previous", page-1)
+	}
+	if page < pages {
+		addLink("next", page+1)
+		addLink("last", pages)
+	}
+}
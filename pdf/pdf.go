@@ -0,0 +1,151 @@
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Pursuit92/gopds"
+)
+
+const PdfType = "application/pdf"
+
+var (
+	pdfinfo  string = "pdfinfo"
+	pdftoppm string = "pdftoppm"
+	// Horizontal size pages are rendered at before any downscaling.
+	renderWidth int = 1600
+)
+
+type Pdf struct {
+	path  string
+	Info  map[string]string
+	Pages int
+	cover []byte
+}
+
+func ReadPdf(path string) (gopds.Ebook, error) {
+	return readPdf(path)
+}
+
+func readPdf(path string) (*Pdf, error) {
+	safePath := filepath.FromSlash(path)
+	info, err := readInfo(safePath)
+	if err != nil {
+		return nil, err
+	}
+	book := &Pdf{path: safePath, Info: info}
+	book.Pages, err = strconv.Atoi(info["Pages"])
+	if err != nil || book.Pages == 0 {
+		return nil, errors.New("No pages found in " + path)
+	}
+	book.cover, _ = renderPage(safePath, 0)
+	return book, nil
+}
+
+// readInfo collects the "Key: value" lines printed by pdfinfo.
+func readInfo(path string) (map[string]string, error) {
+	out, err := exec.Command(pdfinfo, "-isodates", path).Output()
+	if err != nil {
+		return nil, errors.New("pdfinfo " + path + ": " + err.Error())
+	}
+	info := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		info[line[:i]] = strings.TrimSpace(line[i+1:])
+	}
+	return info, scanner.Err()
+}
+
+// renderPage rasterizes page n (counting from 0) to a JPEG.
+func renderPage(path string, n int) ([]byte, error) {
+	page := strconv.Itoa(n + 1)
+	cmd := exec.Command(pdftoppm, "-f", page, "-l", page, "-singlefile", "-jpeg",
+		"-scale-to-x", strconv.Itoa(renderWidth), "-scale-to-y", "-1", path)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.New("pdftoppm " + path + ": " + err.Error())
+	}
+	return out, nil
+}
+
+func (book Pdf) Cover() io.ReadCloser {
+	return ioutil.NopCloser(bytes.NewReader(book.cover))
+}
+
+// Thumb returns nil: the server makes thumbnails from the cover.
+func (book Pdf) Thumb() io.ReadCloser {
+	return nil
+}
+
+func (book Pdf) Book() io.ReadCloser {
+	file, _ := os.Open(book.path)
+	return file
+}
+
+func (book Pdf) OpdsMeta() *gopds.OpdsMeta {
+	info := book.Info
+	meta := &gopds.OpdsMeta{Title: info["Title"],
+		Summary:   info["Subject"],
+		Issued:    info["CreationDate"],
+		Pages:     book.Pages,
+		BookType:  PdfType,
+		Cover:     book.cover != nil,
+		CoverType: "image/jpeg"}
+	if meta.Title == "" {
+		base := filepath.Base(book.path)
+		meta.Title = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if info["Author"] != "" {
+		meta.Authors = []*gopds.OpdsAuthor{{Name: info["Author"]}}
+	}
+	return meta
+}
+
+func (book *Pdf) Close() {
+	os.Remove(book.path)
+}
+
+type pager struct {
+	path  string
+	pages int
+}
+
+func OpenPages(path string) (gopds.Pager, error) {
+	info, err := readInfo(path)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := strconv.Atoi(info["Pages"])
+	if err != nil {
+		return nil, err
+	}
+	return &pager{path, pages}, nil
+}
+
+func (p *pager) PageCount() int {
+	return p.pages
+}
+
+func (p *pager) Page(n int) (io.ReadCloser, string, error) {
+	page, err := renderPage(p.path, n)
+	if err != nil {
+		return nil, "", err
+	}
+	return ioutil.NopCloser(bytes.NewReader(page)), "image/jpeg", nil
+}
+
+func (p *pager) Close() {
+}
@@ -0,0 +1,116 @@
+package pdf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakePoppler replaces pdfinfo with a script printing info and pdftoppm
+// with one printing its arguments in place of the rendered page.
+func fakePoppler(t *testing.T, info string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	write := func(name, script string) string {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	oldInfo, oldPpm := pdfinfo, pdftoppm
+	t.Cleanup(func() { pdfinfo, pdftoppm = oldInfo, oldPpm })
+	pdfinfo = write("pdfinfo", "cat <<'EOF'\n"+info+"EOF\n")
+	pdftoppm = write("pdftoppm", `echo "$@"`+"\n")
+}
+
+func tempPdf(t *testing.T, name string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte("%PDF-1.4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadPdf(t *testing.T) {
+	fakePoppler(t, "Title:          A Title\nAuthor:         Ann Author\n"+
+		"Subject:        About: colons\nCreationDate:   2001-02-03T04:05:06Z\nPages:          12\n")
+	path := tempPdf(t, "book.pdf")
+	book, err := readPdf(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := book.OpdsMeta()
+	if meta.Title != "A Title" || meta.Summary != "About: colons" || meta.Issued != "2001-02-03T04:05:06Z" ||
+		meta.Pages != 12 || meta.BookType != PdfType || !meta.Cover {
+		t.Errorf("meta %+v", meta)
+	}
+	if len(meta.Authors) != 1 || meta.Authors[0].Name != "Ann Author" {
+		t.Errorf("authors %+v", meta.Authors)
+	}
+	cover, _ := ioutil.ReadAll(book.Cover())
+	want := "-f 1 -l 1 -singlefile -jpeg -scale-to-x 1600 -scale-to-y -1 " + path + "\n"
+	if string(cover) != want {
+		t.Errorf("cover rendered with %q, want %q", cover, want)
+	}
+	book.Close()
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Close left %s: %v", path, err)
+	}
+}
+
+func TestReadPdfUntitled(t *testing.T) {
+	fakePoppler(t, "Pages:          3\n")
+	book, err := readPdf(tempPdf(t, "Some Scan.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer book.Close()
+	meta := book.OpdsMeta()
+	if meta.Title != "Some Scan" || meta.Authors != nil {
+		t.Errorf("meta %+v", meta)
+	}
+}
+
+func TestReadPdfNoPages(t *testing.T) {
+	for _, info := range []string{"Title: Empty\nPages: 0\n", "Title: Broken\n"} {
+		fakePoppler(t, info)
+		if _, err := readPdf(tempPdf(t, "empty.pdf")); err == nil || !strings.Contains(err.Error(), "No pages") {
+			t.Errorf("%q: %v", info, err)
+		}
+	}
+	pdfinfo = filepath.Join(t.TempDir(), "missing")
+	if _, err := readPdf(tempPdf(t, "book.pdf")); err == nil || !strings.HasPrefix(err.Error(), "pdfinfo ") {
+		t.Errorf("without pdfinfo: %v", err)
+	}
+}
+
+func TestPager(t *testing.T) {
+	fakePoppler(t, "Pages: 5\n")
+	path := tempPdf(t, "book.pdf")
+	p, err := OpenPages(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if p.PageCount() != 5 {
+		t.Errorf("%d pages", p.PageCount())
+	}
+	rc, mime, err := p.Page(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := ioutil.ReadAll(rc)
+	rc.Close()
+	args := strings.Fields(string(page))
+	if mime != "image/jpeg" || !reflect.DeepEqual(args[:4], []string{"-f", "4", "-l", "4"}) {
+		t.Errorf("page 3 is %s rendered with %q", mime, args)
+	}
+}
@@ -0,0 +1,153 @@
+package gopds
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Resources gives access to the files inside a stored book, addressed by
+// their paths from the root of the book's archive.
+type Resources interface {
+	// Spine lists the content documents in reading order.
+	Spine() []string
+	// Open returns the named resource and its MIME type.
+	Open(name string) (io.ReadCloser, string, error)
+	Close()
+}
+
+var errBadPath = errors.New("Invalid resource path")
+
+// ResourceSource registers open as the way to read stored books of
+// bookType in the web reader.
+func (srv *Server) ResourceSource(bookType string, open func(string) (Resources, error)) {
+	srv.resources[bookType] = open
+}
+
+func (srv *Server) openResources(id string) (*OpdsEntry, Resources, error) {
+	book := &OpdsEntry{}
+	err := srv.DB.Get("books", id, book)
+	if err != nil {
+		return nil, nil, err
+	}
+	bookType := book.bookType()
+	open, ok := srv.resources[bookType]
+	if !ok {
+		return nil, nil, fmt.Errorf("Can't read %s in the browser", bookType)
+	}
+	res, err := open(filepath.FromSlash(srv.Files + "/books/" + id))
+	return book, res, err
+}
+
+// cleanResource resolves dot segments in a resource path and rejects the
+// paths that would climb out of the book's archive.
+func cleanResource(name string) (string, error) {
+	clean := path.Clean(name)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") ||
+		strings.HasPrefix(clean, "/") || strings.Contains(name, "\\") {
+		return "", errBadPath
+	}
+	return clean, nil
+}
+
+var readerTemplate = template.Must(template.New("reader").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { margin: 0; display: flex; flex-direction: column; height: 100vh; font-family: sans-serif; }
+nav { display: flex; justify-content: space-between; align-items: center; padding: 0.5em 1em; background: #eee; }
+iframe { flex: 1; border: none; width: 100%; }
+a.disabled { visibility: hidden; }
+</style>
+</head>
+<body>
+<nav>
+<a href="?n={{.Prev}}"{{if lt .Prev 0}} class="disabled"{{end}}>&larr; Previous</a>
+<span>{{.Title}} ({{.Number}}/{{.Count}})</span>
+<a href="?n={{.Next}}"{{if ge .Next .Count}} class="disabled"{{end}}>Next &rarr;</a>
+</nav>
+<iframe src="{{.Src}}"></iframe>
+</body>
+</html>
+`))
+
+type readerPage struct {
+	Title                     string
+	Src                       string
+	Number, Count, Prev, Next int
+}
+
+func (srv *Server) serveReader(w http.ResponseWriter, r *http.Request, id string) {
+	book, res, err := srv.openResources(id)
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	spine := res.Spine()
+	res.Close()
+	if len(spine) == 0 {
+		http.Error(w, "Book has no readable documents", 404)
+		return
+	}
+	n, _ := strconv.Atoi(r.FormValue("n"))
+	if n < 0 || n >= len(spine) {
+		n = 0
+	}
+	src := &url.URL{Path: "/read/" + id + "/" + spine[n]}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	readerTemplate.Execute(w, readerPage{Title: book.Title,
+		Src:    src.String(),
+		Number: n + 1,
+		Count:  len(spine),
+		Prev:   n - 1,
+		Next:   n + 1})
+}
+
+func (srv *Server) serveResource(w http.ResponseWriter, r *http.Request, id, name string) {
+	name, err := cleanResource(name)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	_, res, err := srv.openResources(id)
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	defer res.Close()
+	rc, mime, err := res.Open(name)
+	if err != nil {
+		http.Error(w, "Resource not found", 404)
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", mime)
+	// Books share the catalog's origin, so their scripts mustn't run.
+	w.Header().Set("Content-Security-Policy", "script-src 'none'")
+	io.Copy(w, rc)
+}
+
+// handleRead serves the reader page at /read/<id> and the resources of
+// the book below it.
+func (srv *Server) handleRead(w http.ResponseWriter, r *http.Request) {
+	components := strings.SplitN(r.URL.Path, "/", 3)
+	if len(components) < 2 || components[1] == "" {
+		http.Error(w, "Must give book uuid", 404)
+		return
+	}
+	id := components[1]
+	if len(components) < 3 || components[2] == "" {
+		srv.serveReader(w, r, id)
+		return
+	}
+	srv.serveResource(w, r, id, components[2])
+}
@@ -0,0 +1,27 @@
+package gopds
+
+import "testing"
+
+func TestCleanResource(t *testing.T) {
+	tests := []struct {
+		name, want string
+		ok         bool
+	}{
+		{"OEBPS/ch1.xhtml", "OEBPS/ch1.xhtml", true},
+		{"OEBPS/text/../images/a.png", "OEBPS/images/a.png", true},
+		{"./images/a.png", "images/a.png", true},
+		{"a//b", "a/b", true},
+		{"../a.png", "", false},
+		{"OEBPS/../../a.png", "", false},
+		{"/etc/passwd", "", false},
+		{"OEBPS\\..\\a.png", "", false},
+		{".", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, err := cleanResource(tt.name)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("cleanResource(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
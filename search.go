@@ -2,18 +2,164 @@ package gopds
 
 import (
 	"strings"
+	"strconv"
 	"log"
 	"encoding/json"
 )
 
+// queryFilter is a field condition in a search, such as lang:es or
+// issued>2000.
+type queryFilter struct {
+	field string
+	// ":" matches, or one of "<", "<=", ">", ">=" compares
+	op string
+	value string
+}
+
+// Fields a query can filter on, and the values each compares against.
+var queryFields = map[string]func(*OpdsEntry) []string{
+	"title": func(e *OpdsEntry) []string { return []string{e.Title} },
+	"author": func(e *OpdsEntry) []string {
+		names := []string{}
+		for _,v := range e.Authors {
+			names = append(names,v.Name)
+		}
+		return names
+	},
+	"lang": func(e *OpdsEntry) []string { return append([]string{e.Lang},e.Languages...) },
+	"subject": func(e *OpdsEntry) []string { return append([]string{e.Category},e.Subjects...) },
+	"series": func(e *OpdsEntry) []string { return []string{e.Series} },
+	"publisher": func(e *OpdsEntry) []string { return []string{e.Publisher} },
+	"format": func(e *OpdsEntry) []string { return []string{e.bookType(),formatName(e.bookType())} },
+	"issued": func(e *OpdsEntry) []string { return []string{e.Issued} },
+	"added": func(e *OpdsEntry) []string { return []string{e.Added} },
+	"updated": func(e *OpdsEntry) []string { return []string{e.Updated} },
+	"pages": func(e *OpdsEntry) []string { return []string{strconv.Itoa(e.Pages)} },
+}
+
+// queryWords splits a query at spaces outside of double quotes.
+func queryWords(query string) []string {
+	words := []string{}
+	word,quoted := []rune{},false
+	for _,r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if len(word) > 0 {
+				words = append(words,string(word))
+			}
+			word = word[:0]
+		default:
+			word = append(word,r)
+		}
+	}
+	if len(word) > 0 {
+		words = append(words,string(word))
+	}
+	return words
+}
+
+// parseQuery separates the field filters of a search from its free text.
+// A filter is a field name followed by ":" for a case-insensitive match
+// (see matchValue), or by <, <=, > or >= to compare. Dates compare on as
+// much of them as the value gives, so issued>2000 means published after
+// 2000, and pages compare as numbers. Values with spaces are quoted, as in
+// subject:"science fiction". Anything else is text to search for.
+func parseQuery(query string) (string,[]*queryFilter) {
+	text := []string{}
+	filters := []*queryFilter{}
+	for _,word := range queryWords(query) {
+		i := strings.IndexAny(word,":<>")
+		if i > 0 {
+			op := word[i:i+1]
+			if op != ":" && strings.HasPrefix(word[i+1:],"=") {
+				op += "="
+			}
+			field := strings.ToLower(word[:i])
+			value := word[i+len(op):]
+			if _,ok := queryFields[field]; ok && value != "" {
+				filters = append(filters,&queryFilter{field,op,value})
+				continue
+			}
+		}
+		text = append(text,word)
+	}
+	return strings.Join(text," "),filters
+}
+
+func (f *queryFilter) match(entry *OpdsEntry) bool {
+	for _,v := range queryFields[f.field](entry) {
+		if v == "" {
+			continue
+		}
+		if f.op == ":" {
+			if matchValue(f.field,v,f.value) {
+				return true
+			}
+			continue
+		}
+		var cmp int
+		if f.field == "pages" {
+			n,_ := strconv.Atoi(v)
+			want,err := strconv.Atoi(f.value)
+			if err != nil {
+				return false
+			}
+			cmp = n - want
+		} else {
+			if len(v) > len(f.value) {
+				v = v[:len(f.value)]
+			}
+			cmp = strings.Compare(v,f.value)
+		}
+		switch {
+		case f.op == "<" && cmp < 0,
+			f.op == "<=" && cmp <= 0,
+			f.op == ">" && cmp > 0,
+			f.op == ">=" && cmp >= 0:
+			return true
+		}
+	}
+	return false
+}
+
+// matchValue reports whether v matches the ":" filter value. Languages
+// match whole BCP 47 subtags, so lang:en finds en-GB but not ben, and
+// formats match a whole MIME type or format name. Other fields match
+// anywhere in the value.
+func matchValue(field,v,value string) bool {
+	v,value = strings.ToLower(v),strings.ToLower(value)
+	switch field {
+	case "lang":
+		v = strings.Replace(v,"_","-",-1)
+		value = strings.Replace(value,"_","-",-1)
+		return v == value || strings.HasPrefix(v,value+"-")
+	case "format":
+		return v == value
+	}
+	return strings.Contains(v,value)
+}
+
+func matchFilters(entry *OpdsEntry,filters []*queryFilter) bool {
+	for _,v := range filters {
+		if !v.match(entry) {
+			return false
+		}
+	}
+	return true
+}
+
 func scoreEntry(search string, entry *OpdsEntry) {
 	search = strings.ToUpper(search)
 	summary := strings.ToUpper(entry.Summary)
 	title := strings.ToUpper(entry.Title)
 	toSearch := []string{summary,title}
-	if entry.Author != nil {
-		author := strings.ToUpper(entry.Author.Name)
-		toSearch = append(toSearch,author)
+	for _,v := range entry.Authors {
+		toSearch = append(toSearch,strings.ToUpper(v.Name))
+	}
+	for _,v := range entry.Contributors {
+		toSearch = append(toSearch,strings.ToUpper(v.Name))
 	}
 	if entry.Content != nil {
 		content := strings.ToUpper(entry.Content.Content)
@@ -33,7 +179,11 @@ func scoreEntry(search string, entry *OpdsEntry) {
 	}
 }
 
-func (srv *Server) Search(searchStr string) ([]*OpdsEntry,error) {
+// Search finds the books matching a query of free text and field filters
+// as parseQuery describes. Books must pass every filter and, if there is
+// text, mention it somewhere.
+func (srv *Server) Search(query string) ([]*OpdsEntry,error) {
+	searchStr,filters := parseQuery(query)
 	db := srv.DB
 	booksBytes,err := db.GetAll("books")
 	if err != nil {
@@ -46,12 +196,15 @@ func (srv *Server) Search(searchStr string) ([]*OpdsEntry,error) {
 		if err != nil {
 			return nil,err
 		}
-		scoreEntry(searchStr,books[i])
+		if searchStr != "" {
+			scoreEntry(searchStr,books[i])
+		}
 	}
 	filter := []*OpdsEntry{}
 	for _,v := range books {
-		if v.Order != 0 {
-			createAcqLinks(v)
+		if (searchStr == "" || v.Order != 0) && matchFilters(v,filters) {
+			srv.createBookLinks(v)
+			v.Id = "urn:uuid:" + v.Id
 			filter = append(filter,v)
 		}
 	}
@@ -0,0 +1,132 @@
+package gopds
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQueryWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", []string{}},
+		{"  dune  messiah ", []string{"dune", "messiah"}},
+		{`subject:"science fiction" opera`, []string{"subject:science fiction", "opera"}},
+		{`"whole phrase"`, []string{"whole phrase"}},
+		{`"unclosed quote here`, []string{"unclosed quote here"}},
+	}
+	for _, tt := range tests {
+		if got := queryWords(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("queryWords(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		in      string
+		text    string
+		filters []queryFilter
+	}{
+		{"dune", "dune", nil},
+		{"", "", nil},
+		{"lang:es issued>2000 pages<=300 dune", "dune", []queryFilter{
+			{"lang", ":", "es"}, {"issued", ">", "2000"}, {"pages", "<=", "300"}}},
+		{`subject:"science fiction" space opera`, "space opera", []queryFilter{
+			{"subject", ":", "science fiction"}}},
+		{"Title:Dune", "", []queryFilter{{"title", ":", "Dune"}}},
+		{"issued>=1999-05 added<2024", "", []queryFilter{
+			{"issued", ">=", "1999-05"}, {"added", "<", "2024"}}},
+		{"unknown:x a<b", "unknown:x a<b", nil},
+		{"lang: :es", "lang: :es", nil},
+		{"pages>=", "pages>=", nil},
+	}
+	for _, tt := range tests {
+		text, filters := parseQuery(tt.in)
+		got := []queryFilter(nil)
+		for _, v := range filters {
+			got = append(got, *v)
+		}
+		if text != tt.text || !reflect.DeepEqual(got, tt.filters) {
+			t.Errorf("parseQuery(%q) = %q %+v, want %q %+v", tt.in, text, got, tt.text, tt.filters)
+		}
+	}
+}
+
+func TestQueryFilterMatch(t *testing.T) {
+	entry := &OpdsEntry{Added: "2024-03-05T10:00:00Z",
+		OpdsMeta: &OpdsMeta{
+			Title:     "Dune",
+			Authors:   []*OpdsAuthor{{Name: "Frank Herbert"}},
+			Lang:      "en",
+			Languages: []string{"fr"},
+			Category:  "sf",
+			Subjects:  []string{"Science Fiction"},
+			Issued:    "1965-08-01",
+			Pages:     412}}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"title:dun", true},
+		{"author:HERBERT", true},
+		{"lang:fr", true},
+		{"lang:FR", true},
+		{"lang:es", false},
+		{"lang:e", false},
+		{"lang:en-gb", false},
+		{`subject:"science fiction"`, true},
+		{"subject:sf", true},
+		{"series:dune", false},
+		{"issued>1965", false},
+		{"issued>=1965", true},
+		{"issued<1966", true},
+		{"issued<=1964", false},
+		{"issued>1965-07", true},
+		{"issued<1965-08-02", true},
+		{"added>=2024-03", true},
+		{"added<2024", false},
+		{"pages>400", true},
+		{"pages<400", false},
+		{"pages>=412", true},
+		{"pages>abc", false},
+		{"lang:en issued<1970", true},
+		{"lang:en issued>1970", false},
+		{"format:epub", true},
+		{"format:application/epub+zip", true},
+		{"format:epu", false},
+		{"format:pdf", false},
+		{"", true},
+	}
+	for _, tt := range tests {
+		_, filters := parseQuery(tt.query)
+		if got := matchFilters(entry, filters); got != tt.want {
+			t.Errorf("%q matched %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestMatchValue(t *testing.T) {
+	tests := []struct {
+		field, v, value string
+		want            bool
+	}{
+		{"lang", "en", "en", true},
+		{"lang", "en-GB", "en", true},
+		{"lang", "en_US", "en-us", true},
+		{"lang", "zh-Hant-TW", "zh-hant", true},
+		{"lang", "ben", "en", false},
+		{"lang", "eng", "en", false},
+		{"lang", "en", "en-GB", false},
+		{"format", "EPUB", "epub", true},
+		{"format", "Kobo EPUB", "epub", false},
+		{"format", "application/epub+zip", "epub", false},
+		{"title", "Children of Dune", "dune", true},
+	}
+	for _, tt := range tests {
+		if got := matchValue(tt.field, tt.v, tt.value); got != tt.want {
+			t.Errorf("%s %q matching %q = %v, want %v", tt.field, tt.v, tt.value, got, tt.want)
+		}
+	}
+}
@@ -9,12 +9,14 @@ import (
 	"path/filepath"
 	"encoding/xml"
 	"net/http"
+	"net/url"
 	"fmt"
 	"time"
 	"log"
 	"io"
 	"os"
 	"sync"
+	"strconv"
 	opdsdb "github.com/Pursuit92/gopds/db"
 )
 
@@ -24,6 +26,13 @@ type Server struct {
 	AutoAddPath string
 	addPatterns []AddPattern
 	Mut *sync.Mutex
+	pagers map[string]func(string) (Pager,error)
+	pages *pagerCache
+	writers map[string]MetaWriter
+	conversions []Conversion
+	resources map[string]func(string) (Resources,error)
+	logins *loginCache
+	nav *navCache
 }
 
 func NewServer(dataPath,addPath string) (*Server, error) {
@@ -35,7 +44,7 @@ func NewServer(dataPath,addPath string) (*Server, error) {
 	}
 	info, err := os.Stat(filePath)
 	if err != nil {
-		for _, v := range []string{"books", "thumbs", "covers", "tmp"} {
+		for _, v := range []string{"books", "thumbs", "covers", "cache", "tmp"} {
 			err := os.MkdirAll(filepath.FromSlash(filePath+"/"+v), os.ModeDir|0777)
 			if err != nil {
 				return nil, err
@@ -46,7 +55,17 @@ func NewServer(dataPath,addPath string) (*Server, error) {
 			return nil, errors.New("Not a directory: " + filePath)
 		}
 	}
-	srv := &Server{db, filePath,addPath,[]AddPattern{},&sync.Mutex{}}
+	srv := &Server{DB: db,
+		Files: filePath,
+		AutoAddPath: addPath,
+		addPatterns: []AddPattern{},
+		Mut: &sync.Mutex{},
+		pagers: make(map[string]func(string) (Pager,error)),
+		pages: &pagerCache{},
+		writers: make(map[string]MetaWriter),
+		resources: make(map[string]func(string) (Resources,error)),
+		logins: &loginCache{},
+		nav: &navCache{}}
 	err = srv.initDB()
 	if err != nil {
 		return nil, err
@@ -62,25 +81,15 @@ func (srv *Server) AddBook(book Ebook) error {
 	srv.Mut.Lock()
 	defer srv.Mut.Unlock()
 	defer book.Close()
-	id, err := srv.addBookDB(book.OpdsMeta())
+	meta := book.OpdsMeta()
+	id, err := srv.addBookDB(meta)
 	if err != nil {
 		return err
 	}
-	if book.OpdsMeta().Thumb {
-		thumbPath := filepath.FromSlash(srv.Files + "/thumbs/" + id)
-		file, err := os.Create(thumbPath)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-		thumb := book.Thumb()
-		defer thumb.Close()
-		_, err = io.Copy(file, thumb)
-		if err != nil {
-			return err
-		}
+	for _,v := range meta.Warnings {
+		log.Printf("%s: %s",meta.Title,v)
 	}
-	if book.OpdsMeta().Cover {
+	if meta.Cover {
 		coverPath := filepath.FromSlash(srv.Files + "/covers/" + id)
 		file, err := os.Create(coverPath)
 		if err != nil {
@@ -93,20 +102,22 @@ func (srv *Server) AddBook(book Ebook) error {
 		if err != nil {
 			return err
 		}
+		// thumbnails all come from the cover, in the configured size and
+		// format
+		err = srv.generateThumb(id,meta)
+		if err != nil {
+			log.Printf("Error: generating thumbnail: %s",err.Error())
+		}
 	}
 	bookPath := filepath.FromSlash(srv.Files + "/books/" + id)
-	file, err := os.Create(bookPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
 	bookFile := book.Book()
 	defer bookFile.Close()
-	_, err = io.Copy(file, bookFile)
+	meta.Hash, err = copyHashed(bookPath, bookFile)
 	if err != nil {
 		return err
 	}
-	return nil
+	srv.setPartialMD5(id,meta)
+	return srv.updateBookDB(id, meta)
 }
 
 func (srv *Server) DelBook(id string) error {
@@ -121,6 +132,10 @@ func (srv *Server) DelBook(id string) error {
 	if book.Thumb {
 		os.Remove(filepath.FromSlash(srv.Files + "/thumbs/" + id))
 	}
+	srv.pages.drop(id)
+	srv.clearImageCache(id)
+	srv.clearConversions(id)
+	srv.unindexPartialMD5(book.PartialMD5,id)
 	os.Remove(filepath.FromSlash(srv.Files + "/books/" + id))
 	return srv.DB.Del("books",id)
 }
@@ -198,10 +213,14 @@ func xmlMarshaler(i interface{},s1,s2 string) ([]byte,error) {
 	return []byte(out),nil
 }
 
-func (srv *Server) GetFeed(name string,sortOverride string,marsh func(interface{},string,string) ([]byte,error)) (string, error) {
+func (srv *Server) Feed(req *FeedRequest) (*OpdsFeed,error) {
 	srv.Mut.Lock()
-	feed,err := srv.getFeedDB(name,sortOverride)
-	srv.Mut.Unlock()
+	defer srv.Mut.Unlock()
+	return srv.getFeedDB(req)
+}
+
+func (srv *Server) GetFeed(req *FeedRequest,marsh func(interface{},string,string) ([]byte,error)) (string, error) {
+	feed,err := srv.Feed(req)
 	if err != nil {
 		return "",err
 	}
@@ -209,16 +228,21 @@ func (srv *Server) GetFeed(name string,sortOverride string,marsh func(interface{
 	return string(out),err
 }
 
-func (srv *Server) serveFeed(feed,sortMeth string) func(w http.ResponseWriter,r *http.Request) {
-	return func(w http.ResponseWriter,r *http.Request) {
-		var err error
-		feed,err := srv.GetFeed(feed,sortMeth,xmlMarshaler)
-		if err != nil {
-			http.Error(w,err.Error(),500)
-			return
-		}
-        fmt.Fprintf(w,"%s\n",feed)
+// serveFeed answers browsers with the HTML catalog and everything else
+// with the Atom feed.
+func (srv *Server) serveFeed(w http.ResponseWriter,r *http.Request,req *FeedRequest) {
+	req.Page,_ = strconv.Atoi(r.FormValue("page"))
+	req.User = UserFromRequest(r)
+	if wantsHTML(r) {
+		srv.serveHTMLFeed(w,r,req)
+		return
+	}
+	feed,err := srv.GetFeed(req,xmlMarshaler)
+	if err != nil {
+		http.Error(w,err.Error(),500)
+		return
 	}
+	fmt.Fprintf(w,"%s\n",feed)
 }
 
 func (srv *Server) handleCatalog(w http.ResponseWriter,r *http.Request) {
@@ -228,7 +252,13 @@ func (srv *Server) handleCatalog(w http.ResponseWriter,r *http.Request) {
 		}
 	}()
 	path := r.URL.Path
-	components := strings.Split(path,"/")
+	// split before unescaping, author names may contain slashes
+	components := strings.Split(r.URL.EscapedPath(),"/")
+	for i,v := range components {
+		if unescaped,err := url.PathUnescape(v); err == nil {
+			components[i] = unescaped
+		}
+	}
 	log.Printf("Path: %s",path)
 	log.Printf("Components: %d %v",len(components),components)
 	var feed,sortMeth string
@@ -241,13 +271,13 @@ func (srv *Server) handleCatalog(w http.ResponseWriter,r *http.Request) {
 		sortMeth = components[3]
 		log.Print("Sorting by",sortMeth)
 	}
-	srv.serveFeed(feed,sortMeth)(w,r)
+	srv.serveFeed(w,r,&FeedRequest{Name: feed,Sort: sortMeth,PerPage: PageSize})
 }
 
 func (srv *Server) handleSearch(w http.ResponseWriter,r *http.Request) {
 	searchTerms := r.FormValue("q")
 	log.Print("Searching: " + searchTerms)
-	srv.serveFeed("search:"+searchTerms,"")(w,r)
+	srv.serveFeed(w,r,&FeedRequest{Name: "search:"+searchTerms,PerPage: PageSize})
 }
 
 func (srv *Server) ServeHTTP(port int) error {
@@ -255,9 +285,16 @@ func (srv *Server) ServeHTTP(port int) error {
 		log.Printf("Got %s, redirecting...",r.URL.Path)
         http.Redirect(w,r,"/catalog",301)
     })
-	handleFunc("/api/",srv.handleAPI)
-	handleFunc("/search",srv.handleSearch)
-    handleFunc("/catalog/",srv.handleCatalog)
-    http.Handle("/get/",http.StripPrefix("/get/", http.FileServer(http.Dir(srv.Files))))
+	handleFunc("/api/",srv.authorize(srv.handleAPI))
+	handleFunc("/search",srv.authorize(srv.handleSearch))
+    handleFunc("/catalog/",srv.authorize(srv.handleCatalog))
+	handleFunc("/pse/",srv.authorize(srv.guardBook(RoleReader,pathId,srv.handlePage)))
+	handleFunc("/cover/",srv.authorize(srv.guardBook(RoleGuest,pathId,srv.handleCover)))
+	handleFunc("/convert/",srv.authorize(srv.guardBook(RoleReader,pathId,srv.handleConvert)))
+	handleFunc("/read/",srv.authorize(srv.guardBook(RoleReader,pathId,srv.handleRead)))
+	handleFunc("/kosync/",srv.handleKosync)
+	handleFunc("/book",srv.authorize(srv.guardBook(RoleGuest,formId,srv.handleEntry)))
+	files := http.FileServer(http.Dir(srv.Files))
+    http.Handle("/get/",http.StripPrefix("/get/",srv.authorize(srv.guardFiles(files.ServeHTTP))))
     return http.ListenAndServe(":"+fmt.Sprintf("%d",port),nil)
 }
@@ -0,0 +1,272 @@
+package gopds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errNoShelf = errors.New("Shelf not found")
+
+// shelfName is the feed name of the shelf with the given id.
+func shelfName(id string) string {
+	return "shelf:" + id
+}
+
+// Shelves lists the shelves of user.
+func (srv *Server) Shelves(user string) ([]*OpdsFeedDB, error) {
+	feedsBytes, err := srv.DB.GetAll("nav")
+	if err != nil {
+		return nil, err
+	}
+	shelves := []*OpdsFeedDB{}
+	for _, v := range feedsBytes {
+		feed := &OpdsFeedDB{}
+		err = json.Unmarshal(v, feed)
+		if err != nil {
+			return nil, err
+		}
+		if feed.Shelf && feed.User == user {
+			shelves = append(shelves, feed)
+		}
+	}
+	return shelves, nil
+}
+
+// getShelfEntries builds the navigation entries of the user's personal
+// feeds and shelves, counting only the books acc lets them see.
+func (srv *Server) getShelfEntries(user *User, acc *access) ([]*OpdsEntry, error) {
+	entries := []*OpdsEntry{}
+	if user == nil {
+		return entries, nil
+	}
+	shelves, err := srv.Shelves(user.Name)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(shelves, func(i, j int) bool {
+		return shelves[i].Title < shelves[j].Title
+	})
+	// the personal feeds come first
+	feeds := []*OpdsFeedDB{}
+	for _, v := range personalFeedNames {
+		feed, err := srv.getPersonalFeed(v, user)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, feed)
+	}
+	for i, v := range append(feeds, shelves...) {
+		entry := feedToEntry(v)
+		entry.Content = &OpdsContent{Type: "text", Content: bookCount(acc.visibleBooks(v.Entries))}
+		createNavLinks(entry, v.Type)
+		entry.Id = "urn:uuid:" + entry.Id
+		entry.Order = i
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// NewShelf creates an empty shelf for user.
+func (srv *Server) NewShelf(user, title string) (*OpdsFeedDB, error) {
+	id := Uuidgen()
+	shelf := &OpdsFeedDB{OpdsCommon: &OpdsCommon{
+		Id:      "urn:uuid:" + id,
+		Title:   title,
+		Name:    shelfName(id),
+		Type:    Acq,
+		Updated: time.Now().Format(time.RFC3339)},
+		Parent:  ShelvesFeed.Name,
+		User:    user,
+		Shelf:   true,
+		Sort:    SortOrder,
+		Entries: []string{}}
+	return shelf, srv.setFeed(shelf.Name, shelf)
+}
+
+// GetShelf returns user's shelf with the given id.
+func (srv *Server) GetShelf(user, id string) (*OpdsFeedDB, error) {
+	shelf := &OpdsFeedDB{}
+	err := srv.DB.Get("nav", shelfName(id), shelf)
+	if err != nil || !shelf.Shelf || shelf.User != user {
+		return nil, errNoShelf
+	}
+	return shelf, nil
+}
+
+func (srv *Server) saveShelf(shelf *OpdsFeedDB) error {
+	shelf.Updated = time.Now().Format(time.RFC3339)
+	return srv.setFeed(shelf.Name, shelf)
+}
+
+// shelveBook puts book id on the shelf at position pos, moving it there if
+// it is already shelved. Positions past the end append.
+func shelveBook(shelf *OpdsFeedDB, id string, pos int) {
+	entries := []string{}
+	for _, v := range shelf.Entries {
+		if v != id {
+			entries = append(entries, v)
+		}
+	}
+	if pos < 0 || pos > len(entries) {
+		pos = len(entries)
+	}
+	shelf.Entries = append(entries[:pos], append([]string{id}, entries[pos:]...)...)
+}
+
+func unshelveBook(shelf *OpdsFeedDB, id string) bool {
+	for i, v := range shelf.Entries {
+		if v == id {
+			shelf.Entries = append(shelf.Entries[:i], shelf.Entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type shelfUpdate struct {
+	Title string
+	// Entries, when given, replaces the shelf's books in their new order.
+	Entries []string
+}
+
+// handleShelf manages the requesting user's shelves:
+//
+//	GET    /api/shelf              list shelves
+//	POST   /api/shelf?title=       create a shelf
+//	GET    /api/shelf/<id>         show a shelf
+//	PUT    /api/shelf/<id>         rename or reorder
+//	DELETE /api/shelf/<id>         delete a shelf
+//	PUT    /api/shelf/<id>/<book>  add or move a book, ?position= counts from 0
+//	DELETE /api/shelf/<id>/<book>  remove a book
+func (srv *Server) handleShelf(w http.ResponseWriter, r *http.Request) {
+	user := UserFromRequest(r)
+	if user == nil {
+		http.Error(w, errNoAccount.Error(), 400)
+		return
+	}
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) < 2 || components[1] == "" {
+		switch r.Method {
+		case "GET":
+			shelves, err := srv.Shelves(user.Name)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+			out, _ := json.MarshalIndent(shelves, "", "  ")
+			fmt.Fprintf(w, "%s", out)
+		case "POST":
+			title := r.FormValue("title")
+			if title == "" {
+				http.Error(w, "Must give a title", 400)
+				return
+			}
+			shelf, err := srv.NewShelf(user.Name, title)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+			out, _ := json.MarshalIndent(shelf, "", "  ")
+			fmt.Fprintf(w, "%s", out)
+		}
+		return
+	}
+
+	srv.Mut.Lock()
+	defer srv.Mut.Unlock()
+	shelf, err := srv.GetShelf(user.Name, components[1])
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	if len(components) > 2 && components[2] != "" {
+		srv.handleShelfBook(w, r, shelf, components[2])
+		return
+	}
+	switch r.Method {
+	case "GET":
+		out, _ := json.MarshalIndent(shelf, "", "  ")
+		fmt.Fprintf(w, "%s", out)
+	case "DELETE":
+		err = srv.delFeed(shelf.Name)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+		}
+	case "PUT":
+		update := &shelfUpdate{}
+		err = json.NewDecoder(r.Body).Decode(update)
+		if err != nil {
+			http.Error(w, "Bad shelf: "+err.Error(), 400)
+			return
+		}
+		if update.Title != "" {
+			shelf.Title = update.Title
+		}
+		if update.Entries != nil {
+			// a reorder may only rearrange what is already shelved
+			if len(update.Entries) != len(shelf.Entries) {
+				http.Error(w, "Entries must list every shelved book", 400)
+				return
+			}
+			seen := make(map[string]bool)
+			for _, v := range update.Entries {
+				if seen[v] || !containsString(shelf.Entries, v) {
+					http.Error(w, fmt.Sprintf("Book %s isn't on the shelf or is listed twice", v), 400)
+					return
+				}
+				seen[v] = true
+			}
+			shelf.Entries = update.Entries
+		}
+		err = srv.saveShelf(shelf)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		out, _ := json.MarshalIndent(shelf, "", "  ")
+		fmt.Fprintf(w, "%s", out)
+	}
+}
+
+func (srv *Server) handleShelfBook(w http.ResponseWriter, r *http.Request, shelf *OpdsFeedDB, id string) {
+	switch r.Method {
+	case "PUT":
+		visible, err := srv.bookVisible(r, id)
+		if err == nil && visible {
+			visible, err = srv.DB.Exists("books", id)
+		}
+		if err != nil || !visible {
+			http.Error(w, "Book not found", 404)
+			return
+		}
+		pos := -1
+		if p := r.FormValue("position"); p != "" {
+			pos, err = strconv.Atoi(p)
+			if err != nil {
+				http.Error(w, "Bad position", 400)
+				return
+			}
+		}
+		shelveBook(shelf, id, pos)
+	case "DELETE":
+		if !unshelveBook(shelf, id) {
+			http.Error(w, "Book isn't on the shelf", 404)
+			return
+		}
+	default:
+		return
+	}
+	err := srv.saveShelf(shelf)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	out, _ := json.MarshalIndent(shelf, "", "  ")
+	fmt.Fprintf(w, "%s", out)
+}
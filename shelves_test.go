@@ -0,0 +1,50 @@
+package gopds
+
+import "testing"
+
+func TestShelfEntryCounts(t *testing.T) {
+	srv := newTestServer(t)
+	private := testFeed(Acq, "hidden")
+	private.User = "alice"
+	if err := srv.setFeed("private", private); err != nil {
+		t.Fatal(err)
+	}
+	shelf, err := srv.NewShelf("bob", "Later")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shelf.Entries = []string{"hidden", "shown", "also shown"}
+	if err = srv.saveShelf(shelf); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user *User
+		want string
+	}{
+		{&User{Name: "bob", Role: RoleReader}, "2 books"},
+		{&User{Name: "bob", Role: RoleAdmin}, "3 books"},
+	}
+	for _, tt := range tests {
+		acc, err := srv.accessFor(tt.user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := srv.getShelfEntries(tt.user, acc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, v := range entries {
+			if v.Title == "Later" {
+				found = true
+				if v.Content == nil || v.Content.Content != tt.want {
+					t.Errorf("%s: shelf shows %+v, want %s", tt.user.Role, v.Content, tt.want)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s: no shelf among %d entries", tt.user.Role, len(entries))
+		}
+	}
+}
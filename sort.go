@@ -1,6 +1,7 @@
 package gopds
 
 import (
+	"strings"
 	"time"
 )
 
@@ -45,6 +46,8 @@ const (
 	SortAuthor
 	SortUpdated
 	SortOrder
+	SortSeries
+	SortAdded
 )
 
 var (
@@ -52,16 +55,28 @@ var (
 		SortTitle: SortTitleFunc,
 		SortAuthor: SortAuthorFunc,
 		SortUpdated: SortUpdatedFunc,
-		SortOrder: SortOrderFunc}
+		SortOrder: SortOrderFunc,
+		SortSeries: SortSeriesFunc,
+		SortAdded: SortAddedFunc}
 	sortFuncStrings map[string]EntryComp = map[string]EntryComp{
 		"title": SortTitleFunc,
 		"author": SortAuthorFunc,
-		"updated": SortUpdatedFunc}
+		"updated": SortUpdatedFunc,
+		"series": SortSeriesFunc,
+		"added": SortAddedFunc}
 )
 
+// authorKey is the sort key of an entry's first author.
+func authorKey(e *OpdsEntry) string {
+	if len(e.Authors) == 0 {
+		return ""
+	}
+	return strings.ToLower(e.Authors[0].SortKey())
+}
+
 func SortAuthorFunc(i,j *OpdsEntry) byte {
-	iName := i.Author.Name
-	jName := j.Author.Name
+	iName := authorKey(i)
+	jName := authorKey(j)
 	if iName == jName {
 		return eq
 	} else if iName < jName {
@@ -81,15 +96,51 @@ func SortTitleFunc(i,j *OpdsEntry) byte {
 	return gt
 }
 
-func SortUpdatedFunc(i,j *OpdsEntry) byte {
-	iTime,_ := time.Parse(i.Updated,time.RFC3339)
-	jTime,_ := time.Parse(j.Updated,time.RFC3339)
-	if jTime.After(iTime) {
+// newestFirst compares two RFC 3339 times, putting the later first.
+func newestFirst(i,j string) byte {
+	iTime,_ := time.Parse(time.RFC3339,i)
+	jTime,_ := time.Parse(time.RFC3339,j)
+	if iTime.Equal(jTime) {
+		return eq
+	} else if iTime.After(jTime) {
 		return lt
 	}
 	return gt
 }
 
+// SortUpdatedFunc puts the most recently updated entries first.
+func SortUpdatedFunc(i,j *OpdsEntry) byte {
+	return newestFirst(i.Updated,j.Updated)
+}
+
+// SortAddedFunc puts the newest additions to the catalog first.
+func SortAddedFunc(i,j *OpdsEntry) byte {
+	return newestFirst(i.Added,j.Added)
+}
+
+// SortSeriesFunc orders by series name, then by position in the series,
+// falling back to the title for books outside of any series.
+func SortSeriesFunc(i,j *OpdsEntry) byte {
+	if i.Series != j.Series {
+		if i.Series == "" {
+			return gt
+		}
+		if j.Series == "" {
+			return lt
+		}
+		if i.Series < j.Series {
+			return lt
+		}
+		return gt
+	}
+	if i.SeriesIndex < j.SeriesIndex {
+		return lt
+	} else if i.SeriesIndex > j.SeriesIndex {
+		return gt
+	}
+	return SortTitleFunc(i,j)
+}
+
 func SortOrderFunc(i,j *OpdsEntry) byte {
 	iName := i.Order
 	jName := j.Order
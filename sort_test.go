@@ -0,0 +1,61 @@
+package gopds
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNewestFirst(t *testing.T) {
+	tests := []struct {
+		i, j string
+		want byte
+	}{
+		{"2024-03-05T10:00:00Z", "2024-03-04T10:00:00Z", lt},
+		{"2024-03-04T10:00:00Z", "2024-03-05T10:00:00Z", gt},
+		{"2024-03-05T10:00:00Z", "2024-03-05T10:00:00Z", eq},
+		// the same instant in another zone
+		{"2024-03-05T12:00:00+02:00", "2024-03-05T10:00:00Z", eq},
+		{"2024-03-05T11:00:00+02:00", "2024-03-05T10:00:00Z", gt},
+		// unparsable and missing times are the oldest
+		{"", "2024-03-05T10:00:00Z", gt},
+		{"2024-03-05T10:00:00Z", "March 2024", lt},
+		{"", "", eq},
+	}
+	for _, tt := range tests {
+		if got := newestFirst(tt.i, tt.j); got != tt.want {
+			t.Errorf("newestFirst(%q, %q) = %d, want %d", tt.i, tt.j, got, tt.want)
+		}
+	}
+}
+
+func TestSortByTime(t *testing.T) {
+	entry := func(id, updated, added string) *OpdsEntry {
+		return &OpdsEntry{Id: id, Updated: updated, Added: added, OpdsMeta: &OpdsMeta{}}
+	}
+	entries := []*OpdsEntry{
+		entry("old", "2024-01-01T00:00:00Z", "2020-01-01T00:00:00Z"),
+		entry("edited", "2024-06-01T00:00:00Z", "2021-01-01T00:00:00Z"),
+		entry("new", "2024-03-01T00:00:00Z", "2024-03-01T00:00:00Z"),
+		entry("undated", "2023-01-01T00:00:00Z", ""),
+	}
+	tests := []struct {
+		name string
+		comp EntryComp
+		want []string
+	}{
+		{"updated", SortUpdatedFunc, []string{"edited", "new", "old", "undated"}},
+		{"added", SortAddedFunc, []string{"new", "edited", "old", "undated"}},
+	}
+	for _, tt := range tests {
+		sorted := append([]*OpdsEntry{}, entries...)
+		sort.Sort(NewEntrySorter(sorted, tt.comp))
+		got := []string{}
+		for _, v := range sorted {
+			got = append(got, v.Id)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("by %s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package txt
+
+import (
+	"bytes"
+	"encoding/xml"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/Pursuit92/gopds/epub"
+)
+
+var (
+	chapterExp *regexp.Regexp = regexp.MustCompile(`^(CHAPTER|Chapter|BOOK|Book|PART|Part)\s+[\dIVXLCivxlc]+\b`)
+	headingExp *regexp.Regexp = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	listExp    *regexp.Regexp = regexp.MustCompile(`^\s*([-*+]|\d+\.)\s+(.*)$`)
+	strongExp  *regexp.Regexp = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	emExp      *regexp.Regexp = regexp.MustCompile(`\*(.+?)\*|_(.+?)_`)
+	codeExp    *regexp.Regexp = regexp.MustCompile("`([^`]+)`")
+)
+
+// HTML elements dropped when importing a page, either because they don't
+// carry text or because they would reference files that aren't bundled.
+var dropElements = map[string]bool{
+	"head":     true,
+	"script":   true,
+	"style":    true,
+	"img":      true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"form":     true,
+	"input":    true,
+	"button":   true,
+	"noscript": true,
+	"link":     true,
+	"meta":     true,
+}
+
+// Elements that implicitly end an open paragraph in HTML.
+var blockElements = map[string]bool{
+	"p":          true,
+	"div":        true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"ul":         true,
+	"ol":         true,
+	"pre":        true,
+	"table":      true,
+	"blockquote": true,
+	"hr":         true,
+}
+
+var voidElements = map[string]bool{
+	"br":  true,
+	"hr":  true,
+	"wbr": true,
+}
+
+func escape(s string) string {
+	return html.EscapeString(s)
+}
+
+// textChapters splits plain text into paragraphs on blank lines, starting
+// a new chapter at lines like "CHAPTER IV".
+func textChapters(lines []string) []epub.Chapter {
+	chapters := []epub.Chapter{}
+	cur := &epub.Chapter{}
+	body := &bytes.Buffer{}
+	para := []string{}
+	flush := func() {
+		if len(para) > 0 {
+			body.WriteString("<p>" + escape(strings.Join(para, " ")) + "</p>\n")
+			para = para[:0]
+		}
+	}
+	for _, v := range lines {
+		v = strings.TrimSpace(v)
+		switch {
+		case v == "":
+			flush()
+		case chapterExp.MatchString(v) && len(para) == 0:
+			if body.Len() > 0 {
+				cur.Body = body.Bytes()
+				chapters = append(chapters, *cur)
+				body = &bytes.Buffer{}
+			}
+			cur = &epub.Chapter{Title: v}
+			body.WriteString("<h2>" + escape(v) + "</h2>\n")
+		default:
+			para = append(para, v)
+		}
+	}
+	flush()
+	cur.Body = body.Bytes()
+	return append(chapters, *cur)
+}
+
+func markdownInline(s string) string {
+	s = escape(s)
+	s = codeExp.ReplaceAllString(s, "<code>$1</code>")
+	s = strongExp.ReplaceAllString(s, "<strong>$1$2</strong>")
+	s = emExp.ReplaceAllString(s, "<em>$1$2</em>")
+	return s
+}
+
+// markdownChapters handles the common subset of Markdown: headings,
+// paragraphs, lists, fenced code and inline emphasis. Each level one
+// heading starts a new chapter.
+func markdownChapters(lines []string) []epub.Chapter {
+	chapters := []epub.Chapter{}
+	cur := &epub.Chapter{}
+	body := &bytes.Buffer{}
+	para := []string{}
+	list := ""
+	code := false
+	flush := func() {
+		if len(para) > 0 {
+			body.WriteString("<p>" + markdownInline(strings.Join(para, " ")) + "</p>\n")
+			para = para[:0]
+		}
+		if list != "" {
+			body.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	for _, v := range lines {
+		trimmed := strings.TrimSpace(v)
+		if strings.HasPrefix(trimmed, "```") {
+			if code {
+				body.WriteString("</code></pre>\n")
+			} else {
+				flush()
+				body.WriteString("<pre><code>")
+			}
+			code = !code
+			continue
+		}
+		if code {
+			body.WriteString(escape(v) + "\n")
+			continue
+		}
+		if trimmed == "" {
+			flush()
+			continue
+		}
+		if m := headingExp.FindStringSubmatch(trimmed); m != nil {
+			flush()
+			level := string('0' + byte(len(m[1])))
+			if len(m[1]) == 1 {
+				if body.Len() > 0 {
+					cur.Body = body.Bytes()
+					chapters = append(chapters, *cur)
+					body = &bytes.Buffer{}
+				}
+				cur = &epub.Chapter{Title: m[2]}
+			}
+			body.WriteString("<h" + level + ">" + markdownInline(m[2]) + "</h" + level + ">\n")
+			continue
+		}
+		if m := listExp.FindStringSubmatch(v); m != nil {
+			kind := "ul"
+			if m[1][0] >= '0' && m[1][0] <= '9' {
+				kind = "ol"
+			}
+			if len(para) > 0 || list != kind {
+				flush()
+				list = kind
+				body.WriteString("<" + list + ">\n")
+			}
+			body.WriteString("<li>" + markdownInline(m[2]) + "</li>\n")
+			continue
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			trimmed = strings.TrimSpace(strings.TrimLeft(trimmed, ">"))
+		}
+		para = append(para, trimmed)
+	}
+	if code {
+		body.WriteString("</code></pre>\n")
+	}
+	flush()
+	cur.Body = body.Bytes()
+	return append(chapters, *cur)
+}
+
+// convertHTML collects the <title>, <meta> tags and lang attribute of an
+// HTML page and re-serializes its body as well-formed XHTML.
+func convertHTML(text string) (map[string]string, []byte) {
+	head := make(map[string]string)
+	body := &bytes.Buffer{}
+	dec := xml.NewDecoder(strings.NewReader(text))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	drop := 0
+	inTitle := false
+	open := []string{}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			// io.EOF, or a page too broken to go on; keep what was
+			// salvaged so far.
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			switch name {
+			case "html":
+				if lang := attr(t, "lang"); lang != "" {
+					head["lang"] = lang
+				}
+				continue
+			case "title":
+				inTitle = true
+			case "meta":
+				key := strings.ToLower(attr(t, "name"))
+				if key != "" && head[key] == "" {
+					head[key] = strings.TrimSpace(html.UnescapeString(attr(t, "content")))
+				}
+			case "body":
+				continue
+			}
+			if drop > 0 || dropElements[name] {
+				drop++
+				continue
+			}
+			if blockElements[name] && len(open) > 0 && open[len(open)-1] == "p" {
+				body.WriteString("</p>")
+				open = open[:len(open)-1]
+			}
+			body.WriteString("<" + name)
+			for _, a := range t.Attr {
+				an := strings.ToLower(a.Name.Local)
+				if a.Name.Space != "" || strings.HasPrefix(an, "on") || an == "style" {
+					continue
+				}
+				body.WriteString(" " + an + "=\"" + escape(a.Value) + "\"")
+			}
+			if voidElements[name] {
+				body.WriteString("/>")
+			} else {
+				body.WriteString(">")
+				open = append(open, name)
+			}
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+			switch name {
+			case "html", "body":
+				continue
+			case "title":
+				inTitle = false
+			}
+			if drop > 0 {
+				drop--
+				continue
+			}
+			// Anything other than the innermost element was already
+			// closed implicitly.
+			if len(open) > 0 && open[len(open)-1] == name {
+				body.WriteString("</" + name + ">")
+				open = open[:len(open)-1]
+			}
+		case xml.CharData:
+			if inTitle && head["title"] == "" {
+				head["title"] = strings.TrimSpace(string(t))
+			}
+			if drop == 0 {
+				body.WriteString(escape(string(t)))
+			}
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		body.WriteString("</" + open[i] + ">")
+	}
+	return head, body.Bytes()
+}
+
+func attr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if strings.ToLower(a.Name.Local) == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,271 @@
+package txt
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Pursuit92/gopds"
+	"github.com/Pursuit92/gopds/epub"
+)
+
+const (
+	TextType     = "text/plain"
+	MarkdownType = "text/markdown"
+	HTMLType     = "text/html"
+	EpubType     = "application/epub+zip"
+)
+
+var (
+	wrapEpub bool = false
+
+	headerExp  *regexp.Regexp = regexp.MustCompile(`^(Title|Author|Language|Release Date|Posting Date|Character set encoding):\s*(.*)$`)
+	ebookOfExp *regexp.Regexp = regexp.MustCompile(`(?i)^\W*The Project Gutenberg E-?Book,? of (.+?)(?:, by (.+))?$`)
+	startExp   *regexp.Regexp = regexp.MustCompile(`^\*\*\* ?START OF (THE|THIS) PROJECT GUTENBERG`)
+	endExp     *regexp.Regexp = regexp.MustCompile(`^\*\*\* ?END OF (THE|THIS) PROJECT GUTENBERG`)
+	dateExp    *regexp.Regexp = regexp.MustCompile(`\s*\[.*$`)
+)
+
+// Language names as they appear in Project Gutenberg headers.
+var languages = map[string]string{
+	"english":    "en",
+	"french":     "fr",
+	"german":     "de",
+	"spanish":    "es",
+	"italian":    "it",
+	"portuguese": "pt",
+	"dutch":      "nl",
+	"finnish":    "fi",
+	"swedish":    "sv",
+	"latin":      "la",
+	"russian":    "ru",
+	"chinese":    "zh",
+}
+
+func init() {
+	flag.BoolVar(&wrapEpub, "txt2epub", false, "Offer EPUB downloads of text, Markdown and HTML books")
+}
+
+type Document struct {
+	path     string
+	bookType string
+	meta     *gopds.OpdsMeta
+	text     string
+	chapters []epub.Chapter
+}
+
+func ReadText(path string) (gopds.Ebook, error) {
+	return readDocument(path, TextType, parseText)
+}
+
+func ReadMarkdown(path string) (gopds.Ebook, error) {
+	return readDocument(path, MarkdownType, parseMarkdown)
+}
+
+func ReadHTML(path string) (gopds.Ebook, error) {
+	return readDocument(path, HTMLType, parseHTML)
+}
+
+func readDocument(path, bookType string, parse func(*Document)) (*Document, error) {
+	doc, err := parseDocument(path, bookType, parse)
+	if err != nil {
+		return nil, err
+	}
+	if doc.meta.Title == "" {
+		base := filepath.Base(doc.path)
+		doc.meta.Title = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	// a single chapter is just the book itself
+	if len(doc.chapters) > 1 {
+		doc.meta.Toc = epub.GeneratedToc(doc.chapters)
+	}
+	return doc, nil
+}
+
+func parseDocument(path, bookType string, parse func(*Document)) (*Document, error) {
+	safePath := filepath.FromSlash(path)
+	raw, err := ioutil.ReadFile(safePath)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{path: safePath,
+		bookType: bookType,
+		meta:     &gopds.OpdsMeta{BookType: bookType}}
+	doc.text = toUTF8(raw)
+	parse(doc)
+	return doc, nil
+}
+
+// Conversions offers EPUB downloads of stored text, Markdown and HTML
+// books when -txt2epub is set.
+func Conversions() []gopds.Conversion {
+	if !wrapEpub {
+		return nil
+	}
+	return []gopds.Conversion{epubConversion(TextType, parseText),
+		epubConversion(MarkdownType, parseMarkdown),
+		epubConversion(HTMLType, parseHTML)}
+}
+
+// epubConversion wraps documents of bookType into an EPUB carrying their
+// catalog metadata.
+func epubConversion(bookType string, parse func(*Document)) gopds.Conversion {
+	return gopds.Conversion{Name: "epub",
+		From: bookType,
+		To:   EpubType,
+		Ext:  ".epub",
+		Convert: func(path string, meta *gopds.OpdsMeta, out io.Writer) error {
+			doc, err := parseDocument(path, bookType, parse)
+			if err != nil {
+				return err
+			}
+			return epub.Generate(out, meta, doc.chapters)
+		}}
+}
+
+// toUTF8 assumes text that isn't valid UTF-8 is Windows-1252, which also
+// covers the ISO-8859-1 files common in older archives.
+func toUTF8(raw []byte) string {
+	raw = bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+	return gopds.DecodeString("windows-1252", string(raw))
+}
+
+// parseText reads the Project Gutenberg header, if there is one, and
+// strips the licence boilerplate around the actual text.
+func parseText(doc *Document) {
+	lines := strings.Split(strings.Replace(doc.text, "\r\n", "\n", -1), "\n")
+	start, end := 0, len(lines)
+	for i, v := range lines {
+		v = strings.TrimSpace(v)
+		if startExp.MatchString(v) && start == 0 {
+			start = i + 1
+			continue
+		}
+		if endExp.MatchString(v) {
+			end = i
+			break
+		}
+		if start != 0 {
+			continue
+		}
+		if m := ebookOfExp.FindStringSubmatch(v); m != nil {
+			if doc.meta.Title == "" {
+				doc.meta.Title = strings.TrimSpace(m[1])
+			}
+			if len(doc.meta.Authors) == 0 && m[2] != "" {
+				doc.meta.Authors = []*gopds.OpdsAuthor{{Name: strings.TrimSpace(m[2])}}
+			}
+		}
+		if m := headerExp.FindStringSubmatch(v); m != nil {
+			val := strings.TrimSpace(m[2])
+			switch m[1] {
+			case "Title":
+				doc.meta.Title = val
+			case "Author":
+				doc.meta.Authors = []*gopds.OpdsAuthor{{Name: val}}
+			case "Language":
+				if lang, ok := languages[strings.ToLower(val)]; ok {
+					doc.meta.Lang = lang
+				}
+			case "Release Date", "Posting Date":
+				if doc.meta.Issued == "" {
+					doc.meta.Issued = dateExp.ReplaceAllString(val, "")
+				}
+			}
+		}
+	}
+	doc.chapters = textChapters(lines[start:end])
+}
+
+func parseMarkdown(doc *Document) {
+	text := strings.Replace(doc.text, "\r\n", "\n", -1)
+	// YAML-style front matter
+	if strings.HasPrefix(text, "---\n") {
+		if i := strings.Index(text[4:], "\n---\n"); i >= 0 {
+			for _, v := range strings.Split(text[4:4+i], "\n") {
+				kv := strings.SplitN(v, ":", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				val := strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+				switch strings.ToLower(strings.TrimSpace(kv[0])) {
+				case "title":
+					doc.meta.Title = val
+				case "author":
+					doc.meta.Authors = []*gopds.OpdsAuthor{{Name: val}}
+				case "lang", "language":
+					doc.meta.Lang = val
+				case "date":
+					doc.meta.Issued = val
+				case "description", "summary":
+					doc.meta.Summary = val
+				}
+			}
+			text = text[4+i+5:]
+		}
+	}
+	doc.chapters = markdownChapters(strings.Split(text, "\n"))
+	if doc.meta.Title == "" && len(doc.chapters) > 0 {
+		doc.meta.Title = doc.chapters[0].Title
+	}
+}
+
+func parseHTML(doc *Document) {
+	head, body := convertHTML(doc.text)
+	doc.meta.Title = head["title"]
+	for _, k := range []string{"author", "dc.creator"} {
+		if head[k] != "" {
+			doc.meta.Authors = []*gopds.OpdsAuthor{{Name: head[k]}}
+			break
+		}
+	}
+	if head["dc.title"] != "" {
+		doc.meta.Title = head["dc.title"]
+	}
+	doc.meta.Summary = firstOf(head, "description", "dc.description")
+	doc.meta.Lang = firstOf(head, "dc.language", "lang")
+	doc.meta.Issued = firstOf(head, "dc.date", "date")
+	doc.meta.Publisher = head["dc.publisher"]
+	doc.meta.Rights = head["dc.rights"]
+	doc.chapters = []epub.Chapter{{Title: doc.meta.Title, Body: body}}
+}
+
+func firstOf(m map[string]string, keys ...string) string {
+	for _, k := range keys {
+		if m[k] != "" {
+			return m[k]
+		}
+	}
+	return ""
+}
+
+func (doc Document) Cover() io.ReadCloser {
+	return nil
+}
+
+// Thumb returns nil: the server makes thumbnails from the cover.
+func (doc Document) Thumb() io.ReadCloser {
+	return nil
+}
+
+func (doc Document) Book() io.ReadCloser {
+	file, _ := os.Open(doc.path)
+	return file
+}
+
+func (doc Document) OpdsMeta() *gopds.OpdsMeta {
+	return doc.meta
+}
+
+func (doc *Document) Close() {
+	os.Remove(doc.path)
+}
@@ -0,0 +1,88 @@
+package txt
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Pursuit92/gopds"
+)
+
+func TestEpubConversion(t *testing.T) {
+	tests := []struct {
+		name, bookType, text string
+		parse                func(*Document)
+		chapters             int
+		toc                  []string
+	}{
+		{"tale.txt", TextType, "CHAPTER I\n\nHello.\n\nCHAPTER II\n\nBye.\n", parseText, 2,
+			[]string{"CHAPTER I", "CHAPTER II"}},
+		{"notes.md", MarkdownType, "# One\n\nText\n\n# Two\n\nMore\n", parseMarkdown, 2,
+			[]string{"One", "Two"}},
+		{"page.html", HTMLType, "<html><body><p>Hi</p></body></html>", parseHTML, 1, nil},
+		{"empty.txt", TextType, "", parseText, 1, nil},
+		{"empty.md", MarkdownType, "", parseMarkdown, 1, nil},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		doc, err := readDocument(path, tt.bookType, tt.parse)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		// the original is what gets stored
+		rc := doc.Book()
+		stored, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		if string(stored) != tt.text || doc.meta.BookType != tt.bookType {
+			t.Errorf("%s: stored %q as %s", tt.name, stored, doc.meta.BookType)
+		}
+		var toc []string
+		for i, v := range doc.meta.Toc {
+			toc = append(toc, v.Title)
+			if want := fmt.Sprintf("OEBPS/ch%d.xhtml", i+1); v.Href != want {
+				t.Errorf("%s: toc entry %q links to %s, want %s", tt.name, v.Title, v.Href, want)
+			}
+		}
+		if !reflect.DeepEqual(toc, tt.toc) {
+			t.Errorf("%s: toc %q, want %q", tt.name, toc, tt.toc)
+		}
+
+		out := &bytes.Buffer{}
+		meta := &gopds.OpdsMeta{Title: "Catalog Title"}
+		err = epubConversion(tt.bookType, tt.parse).Convert(path, meta, out)
+		if err != nil {
+			t.Errorf("%s: converting: %s", tt.name, err)
+			continue
+		}
+		zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		for _, f := range zr.File {
+			if f.Name != "OEBPS/content.opf" {
+				continue
+			}
+			rc, _ := f.Open()
+			opf, _ := ioutil.ReadAll(rc)
+			rc.Close()
+			if n := strings.Count(string(opf), "<itemref "); n != tt.chapters {
+				t.Errorf("%s: %d spine items, want %d", tt.name, n, tt.chapters)
+			}
+			if !strings.Contains(string(opf), "<dc:title>Catalog Title</dc:title>") {
+				t.Errorf("%s: catalog title missing:\n%s", tt.name, opf)
+			}
+		}
+	}
+}
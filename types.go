@@ -8,19 +8,38 @@ const (
 	Nav byte = iota
 	Acq
 	Search
+	AuthorIndex
+	Shelves
 )
 
 type OpdsFeed struct {
 	XMLName xml.Name `xml:"feed"`
 	*OpdsCommon
 	XmlNs   string       `xml:"xmlns,attr,omitempty"`
+	XmlNsPse string      `xml:"xmlns:pse,attr,omitempty"`
 	Entries []*OpdsEntry `xml:"entry,omitempty"`
+	// links to the ancestors of the feed, root first
+	Crumbs  []*OpdsLink  `xml:"-"`
 }
 
 type OpdsFeedDB struct {
 	*OpdsCommon
 	Desc    string
+	// Parent names the feed this one sits under, "" for the root.
+	Parent  string `json:",omitempty"`
+	// A feed naming a user or groups is only shown to them and to admins,
+	// along with the feeds and books it lists.
 	User    string `json:",omitempty"`
+	Groups  []string `json:",omitempty"`
+	// Shelf marks a user's reading list, which is private to its User
+	// without hiding the books on it from anyone else.
+	Shelf   bool `json:",omitempty"`
+	// Window limits an acquisition feed to books added in that many
+	// days, or updated if the feed sorts by update.
+	Window  int `json:",omitempty"`
+	// Query makes an acquisition feed list the books matching it, in the
+	// feed's sort order, instead of its Entries.
+	Query   string `json:",omitempty"`
 	Sort    byte
 	Entries []string `json:",omitempty"`
 }
@@ -39,7 +58,9 @@ type OpdsLink struct {
 	Rel    string       `xml:"rel,attr,omitempty"`
 	Href   string       `xml:"href,attr,omitempty"`
 	Type   string       `xml:"type,attr,omitempty"`
+	Title  string       `xml:"title,attr,omitempty" json:",omitempty"`
 	Prices []*OpdsPrice `xml:"http://opds-spec.org/2010/catalog price,omitempty" json:",omitempty"`
+	Count  int          `xml:"pse:count,attr,omitempty" json:",omitempty"`
 }
 
 type OpdsPrice struct {
@@ -50,12 +71,36 @@ type OpdsPrice struct {
 type OpdsAuthor struct {
 	Name string `xml:"name,omitempty"`
 	Uri  string `xml:"uri,omitempty"`
+	FileAs string `xml:"-" json:",omitempty"`
+	// MARC relator code, "aut" for authors
+	Role string `xml:"-" json:",omitempty"`
+}
+
+type OpdsCategory struct {
+	Term   string `xml:"term,attr"`
+	Label  string `xml:"label,attr,omitempty"`
+	Scheme string `xml:"scheme,attr,omitempty"`
+}
+
+type OpdsIdentifier struct {
+	Scheme string `xml:"-" json:",omitempty"`
+	Value  string `xml:",chardata"`
+}
+
+// OpdsTocEntry is one entry of a book's table of contents. Href is the
+// target within the book file, fragment included.
+type OpdsTocEntry struct {
+	Title    string
+	Href     string          `json:",omitempty"`
+	Children []*OpdsTocEntry `json:",omitempty"`
 }
 
 type OpdsEntry struct {
 	Id string `xml:"id,omitempty"`
 	*OpdsMeta
 	Updated  string       `xml:"updated,omitempty"`
+	// when the book was added to the catalog
+	Added    string       `xml:"published,omitempty" json:",omitempty"`
 	Content  *OpdsContent `xml:"content,omitempty" json:",omitempty"`
 	Links    []*OpdsLink  `xml:"link,omitempty" json:",omitempty"`
 	Order	int	`xml:"-"`
@@ -63,19 +108,48 @@ type OpdsEntry struct {
 
 type OpdsMeta struct {
 	Title     string      `xml:"title,omitempty" json:",omitempty"`
-	Author    *OpdsAuthor `xml:"author,omitempty" json:",omitempty"`
+	Authors   []*OpdsAuthor `xml:"author,omitempty" json:",omitempty"`
+	Contributors []*OpdsAuthor `xml:"contributor,omitempty" json:",omitempty"`
+	// Single author of books stored before multiple authors were
+	// supported; moved into Authors by upgradeBooks.
+	LegacyAuthor *OpdsAuthor `xml:"-" json:"Author,omitempty"`
+	Identifiers []*OpdsIdentifier `xml:"http://purl.org/dc/terms/ identifier,omitempty" json:",omitempty"`
 	Publisher string      `xml:"http://purl.org/dc/terms/ publisher,omitempty" json:",omitempty"`
 	Issued    string      `xml:"http://purl.org/dc/terms/ issued,omitempty" json:",omitempty"`
 	Lang      string      `xml:"http://purl.org/dc/terms/ language,omitempty" json:",omitempty"`
+	Languages []string    `xml:"-" json:",omitempty"`
 	Summary   string      `xml:"summary,omitempty" json:",omitempty"`
 	Rights    string      `xml:"rights,omitempty" json:",omitempty"`
-	Category string       `xml:"category,omitempty" json:",omitempty"`
+	Category string       `xml:"-" json:",omitempty"`
+	// Atom categories of the subjects, made when the entry is served
+	Categories []*OpdsCategory `xml:"category,omitempty" json:"-"`
+	Subjects  []string    `xml:"-" json:",omitempty"`
+	Series    string      `xml:"-" json:",omitempty"`
+	SeriesIndex float64   `xml:"-" json:",omitempty"`
+	Pages     int         `xml:"-" json:",omitempty"`
+	Toc       []*OpdsTocEntry `xml:"-" json:",omitempty"`
+	// structural problems found when the book was imported
+	Warnings  []string    `xml:"-" json:",omitempty"`
+	BookType  string      `xml:"-" json:",omitempty"`
+	// hex SHA-256 of the stored book file
+	Hash      string      `xml:"-" json:",omitempty"`
+	// KOReader's partial MD5 of the stored file, naming it to kosync
+	PartialMD5 string     `xml:"-" json:",omitempty"`
 	Cover     bool        `xml:"-"`
 	Thumb     bool        `xml:"-"`
 	CoverType string      `xml:"-"`
 	ThumbType string      `xml:"-"`
 }
 
+// bookType is the MIME type of the stored book. Books stored before the
+// type was recorded are all epubs.
+func (meta *OpdsMeta) bookType() string {
+	if meta.BookType == "" {
+		return "application/epub+zip"
+	}
+	return meta.BookType
+}
+
 type OpdsContent struct {
 	Type    string `xml:"type,attr,omitempty" json:",omitempty"`
 	Content string `xml:",chardata" json:",omitempty"`
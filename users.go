@@ -0,0 +1,281 @@
+package gopds
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User is an account allowed into the catalog. The catalog is open to
+// everyone until the first user is created.
+type User struct {
+	Name string
+	// Password is the bcrypt hash of the user's password.
+	Password []byte
+	// Role is one of the Role constants.
+	Role string `json:",omitempty"`
+	// Groups give access to restricted feeds naming them.
+	Groups []string `json:",omitempty"`
+	// SyncKey is the bcrypt hash of the MD5 of the password, which is what
+	// KOReader sends to the kosync API.
+	SyncKey []byte `json:",omitempty"`
+	// Admin marks administrators made before roles existed.
+	Admin bool `json:",omitempty"`
+}
+
+// Token is an API token, stored under the SHA-256 of its value so the
+// database never holds anything usable as a credential.
+type Token struct {
+	Id      string
+	User    string
+	Name    string
+	Created string
+}
+
+var (
+	errNoUser    = errors.New("Unknown user")
+	errBadLogin  = errors.New("Invalid user name or password")
+	errBadToken  = errors.New("Invalid token")
+	errUserName  = errors.New("User names must be non-empty and can't contain ':'")
+	errNoAccount = errors.New("This needs a user account")
+	errNoAdmin   = errors.New("Nothing can be changed until an admin account is created with -admin")
+	errPassword  = errors.New("Password can't be empty")
+	errRole      = errors.New("Role must be admin, librarian, reader or guest")
+)
+
+type contextKey int
+
+const userKey contextKey = 0
+
+// loginCache remembers recently checked Basic credentials so the image
+// requests of a catalog page don't each pay for a bcrypt comparison.
+type loginCache struct {
+	sync.Mutex
+	sums map[string][32]byte
+}
+
+func (c *loginCache) check(name, password string) bool {
+	c.Lock()
+	defer c.Unlock()
+	sum, ok := c.sums[name]
+	return ok && sum == sha256.Sum256([]byte(password))
+}
+
+func (c *loginCache) remember(name, password string) {
+	c.Lock()
+	defer c.Unlock()
+	if c.sums == nil {
+		c.sums = make(map[string][32]byte)
+	}
+	c.sums[name] = sha256.Sum256([]byte(password))
+}
+
+func (c *loginCache) forget(name string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.sums, name)
+}
+
+// SetUser creates the named user or replaces its role and groups. An
+// existing user keeps its password if password is empty.
+func (srv *Server) SetUser(name, password, role string, groups []string) error {
+	if name == "" || strings.Contains(name, ":") {
+		return errUserName
+	}
+	if !validRole(role) {
+		return errRole
+	}
+	user, err := srv.GetUser(name)
+	if err != nil {
+		if password == "" {
+			return errPassword
+		}
+		user = &User{Name: name}
+	}
+	if password != "" {
+		user.Password, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		user.SyncKey, err = syncKey(password)
+		if err != nil {
+			return err
+		}
+		srv.logins.forget(name)
+	}
+	user.Role, user.Groups, user.Admin = role, groups, false
+	return srv.DB.Set("users", name, user)
+}
+
+// GetUser returns the named user.
+func (srv *Server) GetUser(name string) (*User, error) {
+	user := &User{}
+	err := srv.DB.Get("users", name, user)
+	if err != nil {
+		return nil, errNoUser
+	}
+	return user, nil
+}
+
+// DelUser removes the named user and revokes its tokens.
+func (srv *Server) DelUser(name string) error {
+	if _, err := srv.GetUser(name); err != nil {
+		return err
+	}
+	tokens, err := srv.Tokens(name)
+	if err != nil {
+		return err
+	}
+	for _, v := range tokens {
+		srv.DB.Del("tokens", v.Id)
+	}
+	srv.logins.forget(name)
+	return srv.DB.Del("users", name)
+}
+
+// Users lists every account.
+func (srv *Server) Users() ([]*User, error) {
+	usersBytes, err := srv.DB.GetAll("users")
+	if err != nil {
+		return nil, err
+	}
+	users := make([]*User, len(usersBytes))
+	for i, v := range usersBytes {
+		users[i] = &User{}
+		err = json.Unmarshal(v, users[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+func (srv *Server) hasUsers() bool {
+	n, err := srv.DB.Count("users")
+	// Fail closed: a broken users database mustn't open the catalog.
+	return err != nil || n > 0
+}
+
+func (srv *Server) hasAdmin() bool {
+	users, err := srv.Users()
+	if err != nil {
+		return false
+	}
+	for _, v := range users {
+		if v.Can(RoleAdmin) {
+			return true
+		}
+	}
+	return false
+}
+
+func tokenId(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewToken creates an API token for user. The token itself is only
+// returned here.
+func (srv *Server) NewToken(user, name string) (string, *Token, error) {
+	raw := make([]byte, 32)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", nil, err
+	}
+	token := hex.EncodeToString(raw)
+	t := &Token{Id: tokenId(token),
+		User:    user,
+		Name:    name,
+		Created: time.Now().Format(time.RFC3339)}
+	return token, t, srv.DB.Set("tokens", t.Id, t)
+}
+
+// Tokens lists the tokens of user, or of everyone if user is empty.
+func (srv *Server) Tokens(user string) ([]*Token, error) {
+	tokensBytes, err := srv.DB.GetAll("tokens")
+	if err != nil {
+		return nil, err
+	}
+	tokens := []*Token{}
+	for _, v := range tokensBytes {
+		t := &Token{}
+		err = json.Unmarshal(v, t)
+		if err != nil {
+			return nil, err
+		}
+		if user == "" || t.User == user {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+// authenticate returns the user named by the request's Basic credentials
+// or bearer token.
+func (srv *Server) authenticate(r *http.Request) (*User, error) {
+	if name, password, ok := r.BasicAuth(); ok {
+		user, err := srv.GetUser(name)
+		if err != nil {
+			return nil, errBadLogin
+		}
+		if srv.logins.check(name, password) {
+			return user, nil
+		}
+		if bcrypt.CompareHashAndPassword(user.Password, []byte(password)) != nil {
+			return nil, errBadLogin
+		}
+		srv.logins.remember(name, password)
+		// accounts made before kosync support learn their key at login
+		if len(user.SyncKey) == 0 {
+			user.SyncKey, err = syncKey(password)
+			if err == nil {
+				srv.DB.Set("users", name, user)
+			}
+		}
+		return user, nil
+	}
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		t := &Token{}
+		err := srv.DB.Get("tokens", tokenId(strings.TrimSpace(auth[7:])), t)
+		if err != nil {
+			return nil, errBadToken
+		}
+		return srv.GetUser(t.User)
+	}
+	return nil, errBadLogin
+}
+
+// authorize lets fun handle requests from known users, or from anyone
+// while there are no users.
+func (srv *Server) authorize(fun http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !srv.hasUsers() {
+			fun(w, r)
+			return
+		}
+		user, err := srv.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="gopds"`)
+			http.Error(w, err.Error(), 401)
+			return
+		}
+		fun(w, r.WithContext(context.WithValue(r.Context(), userKey, user)))
+	}
+}
+
+// UserFromRequest returns the user who made an authorized request, or nil
+// while the catalog has no users.
+func UserFromRequest(r *http.Request) *User {
+	user, _ := r.Context().Value(userKey).(*User)
+	return user
+}
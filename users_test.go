@@ -0,0 +1,138 @@
+package gopds
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	srv := newTestServer(t)
+	if err := srv.SetUser("ann", "secret", RoleReader, nil); err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := srv.NewToken("ann", "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		user, pass    string
+		authorization string
+		want          string
+	}{
+		{"basic", "ann", "secret", "", "ann"},
+		{"cached basic", "ann", "secret", "", "ann"},
+		{"wrong password", "ann", "guess", "", ""},
+		{"unknown user", "bob", "secret", "", ""},
+		{"bearer", "", "", "Bearer " + token, "ann"},
+		{"lower case bearer", "", "", "bearer " + token, "ann"},
+		{"bad token", "", "", "Bearer " + token[1:], ""},
+		{"other scheme", "", "", "Digest " + token, ""},
+		{"nothing", "", "", "", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/catalog/", nil)
+		if tt.user != "" {
+			r.SetBasicAuth(tt.user, tt.pass)
+		}
+		if tt.authorization != "" {
+			r.Header.Set("Authorization", tt.authorization)
+		}
+		user, err := srv.authenticate(r)
+		got := ""
+		if err == nil {
+			got = user.Name
+		}
+		if got != tt.want {
+			t.Errorf("%s: authenticated %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestLoginCache(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetUser("ann", "old", RoleReader, nil)
+	login := func(password string) bool {
+		r := httptest.NewRequest("GET", "/catalog/", nil)
+		r.SetBasicAuth("ann", password)
+		_, err := srv.authenticate(r)
+		return err == nil
+	}
+	if !login("old") || !srv.logins.check("ann", "old") {
+		t.Fatal("login wasn't cached")
+	}
+	if srv.logins.check("ann", "wrong") {
+		t.Error("cache accepted the wrong password")
+	}
+	// a new password forgets the cached one
+	if err := srv.SetUser("ann", "new", RoleReader, nil); err != nil {
+		t.Fatal(err)
+	}
+	if login("old") || !login("new") {
+		t.Error("old password still works after the change")
+	}
+	srv.DelUser("ann")
+	if login("new") || srv.logins.check("ann", "new") {
+		t.Error("deleted user can still log in")
+	}
+}
+
+func TestAPIRoles(t *testing.T) {
+	srv := newTestServer(t)
+	for _, v := range []string{RoleGuest, RoleReader, RoleLibrarian, RoleAdmin} {
+		if err := srv.SetUser(v, "pw", v, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	feed := `{"Title":"New","Type":1,"Desc":"d"}`
+	tests := []struct {
+		user, method, path, body string
+		want                     int
+	}{
+		{"", "GET", "/feed/root", "", 401},
+		{RoleGuest, "GET", "/feed/root", "", 200},
+		{RoleGuest, "PUT", "/feed/new", feed, 403},
+		{RoleReader, "PUT", "/feed/new", feed, 403},
+		{RoleLibrarian, "PUT", "/feed/new", feed, 200},
+		{RoleReader, "DELETE", "/feed/new", "", 403},
+		{RoleLibrarian, "DELETE", "/feed/new", "", 200},
+		{RoleLibrarian, "GET", "/user/", "", 403},
+		{RoleLibrarian, "PUT", "/user/eve", `{"Password":"x","Role":"admin"}`, 403},
+		{RoleAdmin, "GET", "/user/", "", 200},
+		{RoleAdmin, "PUT", "/user/eve", `{"Password":"x"}`, 200},
+		{RoleGuest, "POST", "/token/", "", 200},
+		{RoleGuest, "GET", "/token/", "", 200},
+	}
+	for _, tt := range tests {
+		w := serveAPI(srv, tt.method, tt.path, tt.body, tt.user)
+		if w.Code != tt.want {
+			t.Errorf("%s %s as %q: %d %s, want %d", tt.method, tt.path, tt.user, w.Code, w.Body, tt.want)
+		}
+	}
+	if user, err := srv.GetUser("eve"); err != nil || user.role() != RoleReader {
+		t.Errorf("eve is %+v, %v", user, err)
+	}
+}
+
+func TestAPIWithoutUsers(t *testing.T) {
+	srv := newTestServer(t)
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{"GET", "/feed/root", "", 200},
+		{"GET", "/user/", "", 403},
+		{"PUT", "/user/eve", `{"Password":"x","Role":"admin"}`, 403},
+		{"PUT", "/feed/new", `{"Title":"New","Type":1}`, 403},
+		{"DELETE", "/feed/all", "", 403},
+		{"POST", "/token/", "", 400},
+	}
+	for _, tt := range tests {
+		if w := serveAPI(srv, tt.method, tt.path, tt.body, ""); w.Code != tt.want {
+			t.Errorf("%s %s: %d %s, want %d", tt.method, tt.path, w.Code, w.Body, tt.want)
+		}
+	}
+	if srv.hasUsers() {
+		t.Error("an anonymous request created a user")
+	}
+}
@@ -2,9 +2,15 @@ package gopds
 
 import (
 	"crypto/rand"
+	"crypto/sha1"
 	"fmt"
 )
 
+// The URL namespace of RFC 4122, 6ba7b811-9dad-11d1-80b4-00c04fd430c8,
+// under which NameUuid derives its uuids.
+var uuidNamespace = []byte{0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1,
+	0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+
 func Uuidgen() string {
 	b := make([]byte, 16)
 	_, err := rand.Read(b)
@@ -16,3 +22,16 @@ func Uuidgen() string {
 	b[6] = (b[6] | 0x40) & 0x4F
 	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
 }
+
+// NameUuid returns a version 5 uuid for name, so catalog entries that
+// aren't stored anywhere keep the same id from one request to the next.
+func NameUuid(name string) string {
+	h := sha1.New()
+	h.Write(uuidNamespace)
+	h.Write([]byte(name))
+	b := h.Sum(nil)[:16]
+
+	b[8] = (b[8] | 0x80) & 0xBF
+	b[6] = (b[6] | 0x50) & 0x5F
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,59 @@
+package gopds
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNameUuid(t *testing.T) {
+	// expected values from Python's uuid.uuid5(uuid.NAMESPACE_URL, name)
+	tests := []struct {
+		name, want string
+	}{
+		{"https://example.org/", "527dda32-a0de-5105-a042-cb475b5f7d11"},
+		{"author:frank herbert", "450cece6-4caf-57c1-a33e-b27bc862b25f"},
+	}
+	for _, tt := range tests {
+		if got := NameUuid(tt.name); got != tt.want {
+			t.Errorf("NameUuid(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	random := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if id := Uuidgen(); !random.MatchString(id) {
+		t.Errorf("Uuidgen() = %s", id)
+	}
+}
+
+func TestAuthorEntryIds(t *testing.T) {
+	srv := newTestServer(t)
+	srv.updateBookDB("dune", &OpdsMeta{Title: "Dune", Authors: []*OpdsAuthor{{Name: "Frank Herbert"}}})
+	srv.updateBookDB("emma", &OpdsMeta{Title: "Emma", Authors: []*OpdsAuthor{{Name: "Jane Austen"}}})
+	srv.updateBookDB("children", &OpdsMeta{Title: "Children of Dune", Authors: []*OpdsAuthor{{Name: "Frank Herbert"}}})
+	ids := func() map[string]string {
+		acc, err := srv.accessFor(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := srv.getAuthorEntries(acc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make(map[string]string)
+		for _, v := range entries {
+			out[v.Title] = v.Id
+		}
+		return out
+	}
+	first, second := ids(), ids()
+	if len(first) != 2 || first["Herbert, Frank"] != "urn:uuid:"+NameUuid("author:frank herbert") {
+		t.Errorf("author ids %v", first)
+	}
+	for k, v := range first {
+		if second[k] != v {
+			t.Errorf("%s changed id from %s to %s", k, v, second[k])
+		}
+	}
+	if first["Herbert, Frank"] == first["Austen, Jane"] {
+		t.Error("two authors share an id")
+	}
+}